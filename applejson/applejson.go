@@ -0,0 +1,106 @@
+// Package applejson decodes the JSON values apple sends either as strings or as native values,
+// like "true" and true, or "2" and 2. It is shared by the auth and receipt modules.
+package applejson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidBool = errors.New("value is neither a boolean nor a \"true\" or \"false\" string")
+	ErrInvalidInt  = errors.New("value is neither an integer nor an integer string")
+)
+
+// StringBool is a boolean apple sends either as a boolean or as a string
+type StringBool bool
+
+// StringInt is an integer apple sends either as a number or as a string.
+// An empty string is 0.
+type StringInt int
+
+func (b *StringBool) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = StringBool(v)
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return ErrInvalidBool
+		}
+		*b = StringBool(parsed)
+	default:
+		return ErrInvalidBool
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the boolean as a "true" or "false" string, as apple sends it
+func (b StringBool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatBool(bool(b)))
+}
+
+func (i *StringInt) UnmarshalJSON(data []byte) error {
+	number, ok := NumberText(data)
+	if !ok {
+		return ErrInvalidInt
+	}
+
+	if number == "" {
+		*i = 0
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(number)
+	if err != nil {
+		return ErrInvalidInt
+	}
+
+	*i = StringInt(parsed)
+	return nil
+}
+
+// MarshalJSON encodes the integer as a string, as apple sends it
+func (i StringInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.Itoa(int(i)))
+}
+
+// NumberText returns the text of a number sent either as a JSON number or as a string,
+// empty for null and empty strings. Reports false when data is not a number.
+func NumberText(data []byte) (string, bool) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return "", true
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return "", false
+		}
+		data = []byte(strings.TrimSpace(s))
+		if len(data) == 0 {
+			return "", true
+		}
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return "", false
+	}
+	return number.String(), true
+}
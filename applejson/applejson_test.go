@@ -0,0 +1,54 @@
+package applejson
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringBool(t *testing.T) {
+	for data, expected := range map[string]StringBool{`"true"`: true, `true`: true, `"false"`: false, `false`: false, `null`: false} {
+		var b StringBool
+		assert.Nil(t, json.Unmarshal([]byte(data), &b), data)
+		assert.Equal(t, expected, b, data)
+	}
+
+	var b StringBool
+	assert.Equal(t, ErrInvalidBool, json.Unmarshal([]byte(`"yes"`), &b))
+	assert.Equal(t, ErrInvalidBool, json.Unmarshal([]byte(`1`), &b))
+
+	encoded, err := json.Marshal(StringBool(false))
+	assert.Nil(t, err)
+	assert.Equal(t, `"false"`, string(encoded))
+}
+
+func TestStringInt(t *testing.T) {
+	for data, expected := range map[string]StringInt{`"2"`: 2, `2`: 2, `""`: 0, `null`: 0} {
+		var i StringInt
+		assert.Nil(t, json.Unmarshal([]byte(data), &i), data)
+		assert.Equal(t, expected, i, data)
+	}
+
+	var i StringInt
+	assert.Equal(t, ErrInvalidInt, json.Unmarshal([]byte(`"likely"`), &i))
+	assert.Equal(t, ErrInvalidInt, json.Unmarshal([]byte(`1.5`), &i))
+	assert.Equal(t, ErrInvalidInt, json.Unmarshal([]byte(`true`), &i))
+
+	encoded, err := json.Marshal(StringInt(3))
+	assert.Nil(t, err)
+	assert.Equal(t, `"3"`, string(encoded))
+}
+
+func TestNumberText(t *testing.T) {
+	text, ok := NumberText([]byte(`" 1646130600000 "`))
+	assert.True(t, ok)
+	assert.Equal(t, "1646130600000", text)
+
+	text, ok = NumberText([]byte(`1646130600000`))
+	assert.True(t, ok)
+	assert.Equal(t, "1646130600000", text)
+
+	_, ok = NumberText([]byte(`"soon"`))
+	assert.False(t, ok)
+}
@@ -0,0 +1,202 @@
+// authorize builds the authorization URL of the web flow and verifies its callback.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const (
+	AUTHORIZE_URL = "https://appleid.apple.com/auth/authorize"
+
+	// Response types of the authorization request
+	ResponseTypeCode        = "code"
+	ResponseTypeCodeIDToken = "code id_token"
+
+	// Response modes of the authorization request
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+	ResponseModeFormPost = "form_post"
+
+	// Scopes of the user information to share on the first sign in
+	ScopeName  = "name"
+	ScopeEmail = "email"
+
+	// Size in bytes of generated state and nonce, before encoding
+	randomValueSize = 32
+)
+
+var (
+	ErrMissingRedirectURI   = errors.New("authorization needs a redirect uri")
+	ErrInvalidResponseType  = errors.New("response type must be code or code id_token")
+	ErrInvalidResponseMode  = errors.New("response mode must be query, fragment or form_post")
+	ErrScopeNeedsFormPost   = errors.New("scopes can only be requested with the form_post response mode")
+	ErrIDTokenNeedsFragment = errors.New("code id_token response type can not be used with the query response mode")
+	ErrStateMismatch        = errors.New("callback state does not match the authorization state")
+)
+
+// Authorization is an authorization request of the web flow.
+// Keep it, like in the session of the browser, until the callback to verify it.
+type Authorization struct {
+	// The URI apple redirects the browser to, registered for the client.
+	RedirectURI string `json:"redirect_uri"`
+
+	// The type of response, ResponseTypeCode or ResponseTypeCodeIDToken.
+	ResponseType string `json:"response_type"`
+
+	// How the response is sent to the redirect URI, query, fragment or form_post.
+	ResponseMode string `json:"response_mode"`
+
+	// The user information to share, ScopeName and ScopeEmail.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// The random value the callback must return.
+	State string `json:"state"`
+
+	// The random value the identity token must contain.
+	Nonce string `json:"nonce"`
+}
+
+// NewAuthorization returns an authorization for redirectURI with random state and nonce.
+// With scopes, the response is posted to the redirect URI (form_post),
+// otherwise it is sent in the query.
+func NewAuthorization(redirectURI string, scopes ...string) (*Authorization, error) {
+	if redirectURI == "" {
+		return nil, ErrMissingRedirectURI
+	}
+
+	state, err := RandomValue()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := RandomValue()
+	if err != nil {
+		return nil, err
+	}
+
+	responseMode := ResponseModeQuery
+	if len(scopes) > 0 {
+		responseMode = ResponseModeFormPost
+	}
+
+	return &Authorization{
+		RedirectURI:  redirectURI,
+		ResponseType: ResponseTypeCode,
+		ResponseMode: responseMode,
+		Scopes:       scopes,
+		State:        state,
+		Nonce:        nonce,
+	}, nil
+}
+
+// RandomValue returns a cryptographically random, URL safe value for state and nonce
+func RandomValue() (string, error) {
+	b := make([]byte, randomValueSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Validate checks the combination of response type, response mode and scopes
+func (a *Authorization) Validate() error {
+	if a.RedirectURI == "" {
+		return ErrMissingRedirectURI
+	}
+
+	switch a.ResponseType {
+	case ResponseTypeCode, ResponseTypeCodeIDToken:
+	default:
+		return ErrInvalidResponseType
+	}
+
+	switch a.ResponseMode {
+	case ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost:
+	default:
+		return ErrInvalidResponseMode
+	}
+
+	if len(a.Scopes) > 0 && a.ResponseMode != ResponseModeFormPost {
+		return ErrScopeNeedsFormPost
+	}
+
+	if a.ResponseType == ResponseTypeCodeIDToken && a.ResponseMode == ResponseModeQuery {
+		return ErrIDTokenNeedsFragment
+	}
+
+	return nil
+}
+
+// CheckState compares the state returned to the callback with the authorization state
+func (a *Authorization) CheckState(state string) error {
+	if a.State == "" || subtle.ConstantTimeCompare([]byte(a.State), []byte(state)) != 1 {
+		return ErrStateMismatch
+	}
+	return nil
+}
+
+// AuthorizationURL returns the URL to send the browser to for the authorization
+func (req *Request) AuthorizationURL(a *Authorization) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+
+	authorizeURL, err := url.Parse(req.endpoints().Authorize)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Add("client_id", req.ClientID)
+	query.Add("redirect_uri", a.RedirectURI)
+	query.Add("response_type", a.ResponseType)
+	query.Add("response_mode", a.ResponseMode)
+
+	if len(a.Scopes) > 0 {
+		query.Add("scope", strings.Join(a.Scopes, " "))
+	}
+
+	if a.State != "" {
+		query.Add("state", a.State)
+	}
+
+	if a.Nonce != "" {
+		query.Add("nonce", a.Nonce)
+	}
+
+	authorizeURL.RawQuery = query.Encode()
+
+	return authorizeURL.String(), nil
+}
+
+// VerifyCallback checks the state of the callback, validates its code
+// and verifies the identity token against the authorization nonce.
+// Returns TokenResponse, the identity token claims and error
+func (req *Request) VerifyCallback(ctx context.Context, a *Authorization, callback *Callback) (*TokenResponse, *IDTokenClaims, error) {
+	if err := a.CheckState(callback.State); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := req.ValidateCodeWithRedirectURI(ctx, callback.Code, a.RedirectURI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []IDTokenOption{WithCode(callback.Code)}
+	if a.Nonce != "" {
+		opts = append(opts, WithNonce(a.Nonce))
+	}
+
+	claims, err := resp.VerifyIDTokenContext(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, claims, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAuthorization(t *testing.T) {
+	a, err := NewAuthorization("https://example.com/callback", ScopeName, ScopeEmail)
+	assert.Nil(t, err)
+	assert.Equal(t, ResponseModeFormPost, a.ResponseMode)
+	assert.Len(t, a.State, 43)
+	assert.Len(t, a.Nonce, 43)
+	assert.NotEqual(t, a.State, a.Nonce)
+
+	a, err = NewAuthorization("https://example.com/callback")
+	assert.Nil(t, err)
+	assert.Equal(t, ResponseModeQuery, a.ResponseMode)
+
+	_, err = NewAuthorization("")
+	assert.Equal(t, ErrMissingRedirectURI, err)
+}
+
+func TestAuthorizationURL(t *testing.T) {
+	req, err := WithPEMKey(&http.Client{}, "1234567890", "com.example.web", "abc123def4", testSecretKey(t))
+	assert.Nil(t, err)
+
+	a := &Authorization{
+		RedirectURI:  "https://example.com/callback",
+		ResponseType: ResponseTypeCode,
+		ResponseMode: ResponseModeFormPost,
+		Scopes:       []string{ScopeName, ScopeEmail},
+		State:        "state-123",
+		Nonce:        "nonce-123",
+	}
+
+	got, err := req.AuthorizationURL(a)
+	assert.Nil(t, err)
+
+	parsed, err := url.Parse(got)
+	assert.Nil(t, err)
+	assert.Equal(t, "appleid.apple.com", parsed.Host)
+	assert.Equal(t, "/auth/authorize", parsed.Path)
+	assert.Equal(t, url.Values{
+		"client_id":     {"com.example.web"},
+		"redirect_uri":  {"https://example.com/callback"},
+		"response_type": {"code"},
+		"response_mode": {"form_post"},
+		"scope":         {"name email"},
+		"state":         {"state-123"},
+		"nonce":         {"nonce-123"},
+	}, parsed.Query())
+
+	a.ResponseMode = ResponseModeQuery
+	_, err = req.AuthorizationURL(a)
+	assert.Equal(t, ErrScopeNeedsFormPost, err)
+
+	a.Scopes = nil
+	a.ResponseType = ResponseTypeCodeIDToken
+	_, err = req.AuthorizationURL(a)
+	assert.Equal(t, ErrIDTokenNeedsFragment, err)
+}
+
+func TestAuthorizationCheckState(t *testing.T) {
+	a := &Authorization{State: "state-123"}
+
+	assert.Nil(t, a.CheckState("state-123"))
+	assert.Equal(t, ErrStateMismatch, a.CheckState("other"))
+	assert.Equal(t, ErrStateMismatch, (&Authorization{}).CheckState(""))
+}
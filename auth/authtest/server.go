@@ -0,0 +1,288 @@
+// Package authtest provides a local stand-in of the apple auth endpoints
+// and of KMS signers, to test sign in with apple flows offline.
+package authtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/auth"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// Lifetime of issued access and id tokens
+	tokenLifetime = time.Hour
+)
+
+// Server emulates the token, revoke and keys endpoints of apple.
+// Codes are issued with IssueCode and exchanged by the token endpoint
+// for tokens with an id token signed by Key.
+type Server struct {
+	*httptest.Server
+
+	// Client id accepted by the server and audience of the id tokens
+	ClientID string
+
+	// Key signing the id tokens, served by the keys endpoint
+	Key   *rsa.PrivateKey
+	KeyID string
+
+	mu            sync.Mutex
+	codes         map[string]grant
+	refreshTokens map[string]auth.User
+	revoked       map[string]bool
+}
+
+// tokenResponse is the body of the token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+}
+
+// grant is the user and nonce an authorization code was issued for
+type grant struct {
+	user  auth.User
+	nonce string
+}
+
+// Returns new started server accepting given client id.
+// Close the server when done.
+func NewServer(clientID string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("authtest: generating key: " + err.Error())
+	}
+
+	s := &Server{
+		ClientID:      clientID,
+		Key:           key,
+		KeyID:         "authtest",
+		codes:         make(map[string]grant),
+		refreshTokens: make(map[string]auth.User),
+		revoked:       make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/keys", s.handleKeys)
+	mux.HandleFunc("/auth/token", s.handleToken)
+	mux.HandleFunc("/auth/revoke", s.handleRevoke)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Endpoints returns the endpoints of the server, to configure the client with auth.UseEndpoints
+func (s *Server) Endpoints() auth.Endpoints {
+	endpoints, _ := auth.EndpointsFromBaseURL(s.URL)
+	return endpoints
+}
+
+// IssueCode returns a one-time authorization code for user,
+// as apple sends to the app after the user signs in.
+// The nonce is added to the id token when not empty.
+func (s *Server) IssueCode(user auth.User, nonce string) string {
+	code := randomToken()
+
+	s.mu.Lock()
+	s.codes[code] = grant{user: user, nonce: nonce}
+	s.mu.Unlock()
+
+	return code
+}
+
+// IssueRefreshToken returns a refresh token for user, as returned by a code validation
+func (s *Server) IssueRefreshToken(user auth.User) string {
+	token := randomToken()
+
+	s.mu.Lock()
+	s.refreshTokens[token] = user
+	s.mu.Unlock()
+
+	return token
+}
+
+// Revoked reports whether token was revoked with the revoke endpoint
+func (s *Server) Revoked(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revoked[token]
+}
+
+// IDToken returns an id token of user signed by the server key.
+// The at_hash claim is set when accessToken is not empty.
+func (s *Server) IDToken(user auth.User, nonce, accessToken string) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss":              auth.AUDIENCE,
+		"aud":              s.ClientID,
+		"sub":              user.ID,
+		"iat":              now.Unix(),
+		"exp":              now.Add(tokenLifetime).Unix(),
+		"auth_time":        now.Unix(),
+		"email_verified":   user.EmailVerified,
+		"is_private_email": user.IsPrivateEmail,
+		"real_user_status": user.RealUserStatus,
+		"nonce_supported":  true,
+	}
+
+	if user.Email != "" {
+		claims["email"] = user.Email
+	}
+
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["at_hash"] = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.KeyID
+
+	return token.SignedString(s.Key)
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.JWKSet{Keys: []auth.JWK{{
+		Alg: "RS256",
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.Key.E)).Bytes()),
+		Kid: s.KeyID,
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(s.Key.N.Bytes()),
+		Use: "sig",
+	}}})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeClient(w, r) {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.mu.Lock()
+		grant, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, auth.InvalidGrant)
+			return
+		}
+
+		s.writeTokens(w, grant.user, grant.nonce, s.IssueRefreshToken(grant.user))
+
+	case "refresh_token":
+		s.mu.Lock()
+		user, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, auth.InvalidGrant)
+			return
+		}
+
+		s.writeTokens(w, user, "", "")
+
+	case "client_credentials":
+		writeJSON(w, http.StatusOK, tokenResponse{
+			AccessToken: randomToken(),
+			ExpiresIn:   int(tokenLifetime.Seconds()),
+			TokenType:   "bearer",
+		})
+
+	default:
+		writeError(w, auth.UnsupportedGrantType)
+	}
+}
+
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeClient(w, r) {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+
+	s.mu.Lock()
+	delete(s.refreshTokens, token)
+	s.revoked[token] = true
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorizeClient checks the client id and the claims of the client secret.
+// The secret signature is not verified, the server does not know the public key.
+func (s *Server) authorizeClient(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeError(w, auth.InvalidRequest)
+		return false
+	}
+
+	if r.PostForm.Get("client_id") != s.ClientID {
+		writeError(w, auth.InvalidClient)
+		return false
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(r.PostForm.Get("client_secret"), &claims)
+	if err != nil || claims.Valid() != nil || claims.Subject != s.ClientID || !claims.VerifyAudience(auth.AUDIENCE, true) {
+		writeError(w, auth.InvalidClient)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) writeTokens(w http.ResponseWriter, user auth.User, nonce, refreshToken string) {
+	accessToken := randomToken()
+
+	idToken, err := s.IDToken(user, nonce, accessToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  accessToken,
+		ExpiresIn:    int(tokenLifetime.Seconds()),
+		IDToken:      idToken,
+		RefreshToken: refreshToken,
+		TokenType:    "bearer",
+	})
+}
+
+func writeError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, auth.ErrorResponse{Error: code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("authtest: reading random: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
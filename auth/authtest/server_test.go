@@ -0,0 +1,119 @@
+package authtest_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/canopas/apple-sdk-go/auth"
+	"github.com/canopas/apple-sdk-go/auth/authtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(t *testing.T, server *authtest.Server) *auth.Request {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	req, err := auth.WithPrivateKey(server.Client(), "1234567890", server.ClientID, "abc123def4", key,
+		auth.UseEndpoints(server.Endpoints()))
+	assert.Nil(t, err)
+
+	return req
+}
+
+func TestServer(t *testing.T) {
+	server := authtest.NewServer("com.example.app")
+	defer server.Close()
+
+	req := newRequest(t, server)
+	user := auth.User{
+		ID:             "001234.abcd",
+		Email:          "john.doe@privaterelay.appleid.com",
+		EmailVerified:  true,
+		IsPrivateEmail: true,
+		RealUserStatus: 2,
+	}
+
+	resp, err := req.ValidateCode(context.Background(), server.IssueCode(user, "nonce-123"))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, resp.RefreshToken)
+
+	got, err := resp.GetUser(auth.WithNonce("nonce-123"))
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	assert.Equal(t, user.Email, got.Email)
+
+	refreshed, err := req.ValidateRefreshToken(context.Background(), resp.RefreshToken)
+	assert.Nil(t, err)
+
+	id, err := refreshed.UniqueID()
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, id)
+
+	assert.Nil(t, req.RevokeRefreshToken(context.Background(), resp.RefreshToken))
+	assert.True(t, server.Revoked(resp.RefreshToken))
+
+	_, err = req.ValidateRefreshToken(context.Background(), resp.RefreshToken)
+	assert.True(t, errors.Is(err, auth.ErrInvalidGrant))
+}
+
+func TestServer__codeIsSingleUse(t *testing.T) {
+	server := authtest.NewServer("com.example.app")
+	defer server.Close()
+
+	req := newRequest(t, server)
+	code := server.IssueCode(auth.User{ID: "001234.abcd"}, "")
+
+	_, err := req.ValidateCode(context.Background(), code)
+	assert.Nil(t, err)
+
+	_, err = req.ValidateCode(context.Background(), code)
+	assert.True(t, errors.Is(err, auth.ErrInvalidGrant))
+}
+
+func TestServer__invalidClient(t *testing.T) {
+	server := authtest.NewServer("com.example.app")
+	defer server.Close()
+
+	req := newRequest(t, server)
+	req.ClientID = "com.other.app"
+
+	_, err := req.ValidateCode(context.Background(), server.IssueCode(auth.User{ID: "001234.abcd"}, ""))
+	assert.True(t, errors.Is(err, auth.ErrInvalidClient))
+}
+
+func TestServer__verifyCallback(t *testing.T) {
+	server := authtest.NewServer("com.example.app")
+	defer server.Close()
+
+	req := newRequest(t, server)
+	user := auth.User{ID: "001234.abcd", Email: "john.doe@example.com"}
+
+	authorization, err := auth.NewAuthorization("https://example.com/callback", auth.ScopeEmail)
+	assert.Nil(t, err)
+
+	callback := &auth.Callback{
+		Code:  server.IssueCode(user, authorization.Nonce),
+		State: authorization.State,
+	}
+
+	_, _, err = req.VerifyCallback(context.Background(), authorization, &auth.Callback{Code: callback.Code, State: "other"})
+	assert.Equal(t, auth.ErrStateMismatch, err)
+
+	_, claims, err := req.VerifyCallback(context.Background(), authorization, callback)
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, claims.Subject)
+
+	other, err := auth.NewAuthorization("https://example.com/callback")
+	assert.Nil(t, err)
+	other.State = authorization.State
+
+	_, _, err = req.VerifyCallback(context.Background(), other, &auth.Callback{
+		Code:  server.IssueCode(user, authorization.Nonce),
+		State: authorization.State,
+	})
+	assert.Equal(t, auth.ErrNonceMismatch, err)
+}
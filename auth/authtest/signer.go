@@ -0,0 +1,72 @@
+package authtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+// Size in bytes of r and s in the raw form of P-256 signatures
+const rawSignatureSize = 32
+
+// Signer stands in for a client secret key kept in an HSM or a KMS.
+// It signs with an in-memory P-256 key, in ASN.1 DER form or, with Raw,
+// in the r||s form returned by some KMS, and counts its signatures.
+// It is safe for concurrent use.
+type Signer struct {
+	// Key signing the digests, its public key verifies the client secrets
+	Key *ecdsa.PrivateKey
+
+	// Signs in r||s form instead of ASN.1 DER
+	Raw bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+// Returns new signer with a generated P-256 key, signing in ASN.1 DER form
+func NewSigner() *Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("authtest: generating key: " + err.Error())
+	}
+
+	return &Signer{Key: key}
+}
+
+// Public returns the public key of Key
+func (s *Signer) Public() crypto.PublicKey {
+	return s.Key.Public()
+}
+
+// Sign signs digest with Key
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+
+	if !s.Raw {
+		return s.Key.Sign(rand, digest, opts)
+	}
+
+	r, sig, err := ecdsa.Sign(rand, s.Key, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 2*rawSignatureSize)
+	r.FillBytes(raw[:rawSignatureSize])
+	sig.FillBytes(raw[rawSignatureSize:])
+	return raw, nil
+}
+
+// Calls returns the number of signatures made
+func (s *Signer) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls
+}
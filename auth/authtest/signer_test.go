@@ -0,0 +1,34 @@
+package authtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/canopas/apple-sdk-go/auth"
+	"github.com/canopas/apple-sdk-go/auth/authtest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	for name, raw := range map[string]bool{"der": false, "raw": true} {
+		t.Run(name, func(t *testing.T) {
+			signer := authtest.NewSigner()
+			signer.Raw = raw
+
+			req, err := auth.WithSigner(&http.Client{}, "1234567890", "com.example.app", "abc123def4", signer)
+			assert.Nil(t, err)
+
+			secret, err := req.GenerateClientSecret()
+			assert.Nil(t, err)
+
+			token, err := jwt.Parse(secret, func(token *jwt.Token) (interface{}, error) {
+				return &signer.Key.PublicKey, nil
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, "ES256", token.Header["alg"])
+			assert.Equal(t, "abc123def4", token.Header["kid"])
+			assert.Equal(t, 1, signer.Calls())
+		})
+	}
+}
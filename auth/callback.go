@@ -0,0 +1,121 @@
+// callback parses the redirect apple sends to the web redirect URI after sign in.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Error codes apple sends to the redirect URI instead of a code
+const (
+	UserCancelledAuthorize = "user_cancelled_authorize"
+)
+
+var (
+	ErrMissingCode       = errors.New("callback has no authorization code")
+	ErrInvalidCallback   = errors.New("callback is neither a form post nor a query redirect")
+	ErrInvalidUserJSON   = errors.New("callback user is not valid JSON")
+	ErrCallbackCancelled = &CallbackError{Code: UserCancelledAuthorize}
+)
+
+// Callback is the authorization response sent to the redirect URI.
+// https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_js/incorporating_sign_in_with_apple_into_other_platforms
+type Callback struct {
+	// The authorization code to validate with ValidateCodeWithRedirectURI.
+	Code string
+
+	// The state of the authorization request.
+	State string
+
+	// The identity token, sent when the id_token response type was requested.
+	IDToken string
+
+	// The user name and email, sent only the first time the user signs in,
+	// and only with the form_post response mode. Nil when not sent.
+	User *CallbackUser
+}
+
+// CallbackUser is the user JSON sent on the first sign in
+type CallbackUser struct {
+	Name CallbackName `json:"name"`
+
+	// The user email, either the real email or the private relay address.
+	Email string `json:"email"`
+}
+
+// CallbackName is the name the user shared
+type CallbackName struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// CallbackError is the error sent to the redirect URI, like user_cancelled_authorize
+type CallbackError struct {
+	Code  string
+	State string
+}
+
+func (e *CallbackError) Error() string {
+	if e.Code == UserCancelledAuthorize {
+		return "the user cancelled the sign in"
+	}
+	return "sign in failed: " + e.Code
+}
+
+// Is reports whether target is a callback error with the same code
+func (e *CallbackError) Is(target error) bool {
+	t, ok := target.(*CallbackError)
+	return ok && t.Code == e.Code
+}
+
+// ParseCallback parses the authorization response of the form_post (POST form)
+// and query (GET query) response modes.
+// Returns *CallbackError when apple sent an error, like ErrCallbackCancelled.
+func ParseCallback(r *http.Request) (*Callback, error) {
+	var values map[string][]string
+
+	switch r.Method {
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		values = r.PostForm
+
+	case http.MethodGet:
+		values = r.URL.Query()
+
+	default:
+		return nil, ErrInvalidCallback
+	}
+
+	get := func(key string) string {
+		if v := values[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	if code := get("error"); code != "" {
+		return nil, &CallbackError{Code: code, State: get("state")}
+	}
+
+	callback := &Callback{
+		Code:    get("code"),
+		State:   get("state"),
+		IDToken: get("id_token"),
+	}
+
+	if callback.Code == "" {
+		return nil, ErrMissingCode
+	}
+
+	if user := get("user"); user != "" {
+		callback.User = &CallbackUser{}
+		if err := json.Unmarshal([]byte(user), callback.User); err != nil {
+			return nil, ErrInvalidUserJSON
+		}
+	}
+
+	return callback, nil
+}
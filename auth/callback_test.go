@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func formPost(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(values.Encode()))
+	r.Header.Set("content-type", CONTENT_TYPE)
+	return r
+}
+
+func TestParseCallback__formPost(t *testing.T) {
+	got, err := ParseCallback(formPost(url.Values{
+		"code":     {"auth-code"},
+		"state":    {"state-123"},
+		"id_token": {"id-token"},
+		"user":     {`{"name":{"firstName":"John","lastName":"Doe"},"email":"john.doe@privaterelay.appleid.com"}`},
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, &Callback{
+		Code:    "auth-code",
+		State:   "state-123",
+		IDToken: "id-token",
+		User: &CallbackUser{
+			Name:  CallbackName{FirstName: "John", LastName: "Doe"},
+			Email: "john.doe@privaterelay.appleid.com",
+		},
+	}, got)
+}
+
+func TestParseCallback__query(t *testing.T) {
+	got, err := ParseCallback(httptest.NewRequest(http.MethodGet, "/callback?code=auth-code&state=state-123", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, &Callback{Code: "auth-code", State: "state-123"}, got)
+}
+
+func TestParseCallback__errors(t *testing.T) {
+	_, err := ParseCallback(formPost(url.Values{"error": {"user_cancelled_authorize"}, "state": {"state-123"}}))
+	assert.True(t, errors.Is(err, ErrCallbackCancelled))
+
+	var callbackErr *CallbackError
+	assert.True(t, errors.As(err, &callbackErr))
+	assert.Equal(t, "state-123", callbackErr.State)
+
+	_, err = ParseCallback(formPost(url.Values{"state": {"state-123"}}))
+	assert.Equal(t, ErrMissingCode, err)
+
+	_, err = ParseCallback(formPost(url.Values{"code": {"auth-code"}, "user": {"{"}}))
+	assert.Equal(t, ErrInvalidUserJSON, err)
+
+	_, err = ParseCallback(httptest.NewRequest(http.MethodPut, "/callback", nil))
+	assert.Equal(t, ErrInvalidCallback, err)
+}
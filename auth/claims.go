@@ -0,0 +1,78 @@
+// claims decodes the claims of identity tokens issued by Apple.
+package auth
+
+import (
+	"github.com/canopas/apple-sdk-go/applejson"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidStringBool = applejson.ErrInvalidBool
+	ErrInvalidStringInt  = applejson.ErrInvalidInt
+)
+
+// Possible values of the real_user_status claim
+const (
+	RealUserStatusUnsupported = 0
+	RealUserStatusUnknown     = 1
+	RealUserStatusLikelyReal  = 2
+)
+
+// StringBool is a boolean claim Apple sends either as a boolean or as a string
+type StringBool = applejson.StringBool
+
+// StringInt is an integer claim Apple sends either as a number or as a string
+type StringInt = applejson.StringInt
+
+// IDTokenClaims are the claims of the identity token.
+// https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_rest_api/authenticating_users_with_sign_in_with_apple
+type IDTokenClaims struct {
+	// Issuer (iss), the unique identifier of the user (sub),
+	// client id (aud), expiration (exp) and issue (iat) times.
+	jwt.RegisteredClaims
+
+	// The time the user authenticated.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// The nonce of the authorization request.
+	Nonce string `json:"nonce,omitempty"`
+
+	// Whether the platform supports the nonce, nil when not sent.
+	NonceSupported *StringBool `json:"nonce_supported,omitempty"`
+
+	// The hash of the authorization code.
+	CHash string `json:"c_hash,omitempty"`
+
+	// The hash of the access token.
+	AtHash string `json:"at_hash,omitempty"`
+
+	// The user email, either the real email or the private relay address.
+	Email string `json:"email,omitempty"`
+
+	// Whether the service verifies the email.
+	EmailVerified StringBool `json:"email_verified,omitempty"`
+
+	// Whether the email is the private relay address.
+	IsPrivateEmail StringBool `json:"is_private_email,omitempty"`
+
+	// Whether the user appears to be a real person.
+	// The possible values are: 0 (or Unsupported), 1 (or Unknown), 2 (or LikelyReal).
+	RealUserStatus StringInt `json:"real_user_status,omitempty"`
+
+	// The transfer identifier of a user migrated between teams.
+	TransferSub string `json:"transfer_sub,omitempty"`
+
+	// The identifier of the organization of a managed Apple ID.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// User returns the user the claims identify
+func (c *IDTokenClaims) User() *User {
+	return &User{
+		ID:             c.Subject,
+		Email:          c.Email,
+		EmailVerified:  bool(c.EmailVerified),
+		IsPrivateEmail: bool(c.IsPrivateEmail),
+		RealUserStatus: int(c.RealUserStatus),
+	}
+}
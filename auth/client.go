@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -10,19 +12,64 @@ import (
 var InvalidSecretFileMsg = "please specify secret key file path"
 
 // Returns new secret request with default client
-func WithDefaultClient(teamId, clientId, keyId, secretKeyPath string) (*Request, error) {
+func WithDefaultClient(teamId, clientId, keyId, secretKeyPath string, opts ...Option) (*Request, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
-	return createRequest(teamId, clientId, keyId, secretKeyPath, client)
+	return createRequest(teamId, clientId, keyId, secretKeyPath, client, opts...)
 }
 
 // Returns new secret request with given client
-func WithCustomClient(client httpClient, teamId, clientId, keyId, secretKeyPath string) (*Request, error) {
-	return createRequest(teamId, clientId, keyId, secretKeyPath, client)
+func WithCustomClient(client httpClient, teamId, clientId, keyId, secretKeyPath string, opts ...Option) (*Request, error) {
+	return createRequest(teamId, clientId, keyId, secretKeyPath, client, opts...)
 }
 
-func createRequest(teamId, clientId, keyId, secretKeyPath string, client httpClient) (*Request, error) {
+// Returns new secret request with given client and PEM encoded private key (.p8 file content)
+func WithPEMKey(client httpClient, teamId, clientId, keyId string, pemKey []byte, opts ...Option) (*Request, error) {
+	source, err := KeyFromPEM(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	return WithKeySource(client, teamId, clientId, keyId, source, opts...)
+}
+
+// Returns new secret request with given client and parsed private key
+func WithPrivateKey(client httpClient, teamId, clientId, keyId string, key *ecdsa.PrivateKey, opts ...Option) (*Request, error) {
+	source, err := KeyFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return WithKeySource(client, teamId, clientId, keyId, source, opts...)
+}
+
+// Returns new secret request with given client and key source
+func WithKeySource(client httpClient, teamId, clientId, keyId string, source KeySource, opts ...Option) (*Request, error) {
+	if source == nil {
+		return nil, ErrNilKeySource
+	}
+
+	return New(append([]Option{
+		UseCredentials(teamId, clientId, keyId),
+		UseHTTPClient(client),
+		UseKeySource(source),
+	}, opts...)...)
+}
+
+// Returns new secret request with given client and signer,
+// for keys kept in an HSM or a KMS
+func WithSigner(client httpClient, teamId, clientId, keyId string, signer crypto.Signer, opts ...Option) (*Request, error) {
+	if err := validateSigner(signer); err != nil {
+		return nil, err
+	}
+
+	return New(append([]Option{
+		UseCredentials(teamId, clientId, keyId),
+		UseHTTPClient(client),
+		UseSigner(signer),
+	}, opts...)...)
+}
+
+func createRequest(teamId, clientId, keyId, secretKeyPath string, client httpClient, opts ...Option) (*Request, error) {
 
 	if secretKeyPath == "" {
 		return nil, errors.New(InvalidSecretFileMsg)
@@ -34,11 +81,12 @@ func createRequest(teamId, clientId, keyId, secretKeyPath string, client httpCli
 		return nil, err
 	}
 
-	return &Request{
-		TeamID:       teamId,
-		ClientID:     clientId,
-		KeyID:        keyId,
-		ClientSecret: secretContent,
-		HttpClient:   client,
-	}, nil
+	req, err := WithPEMKey(client, teamId, clientId, keyId, secretContent, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	req.ClientSecret = secretContent
+
+	return req, nil
 }
@@ -0,0 +1,90 @@
+// endpoints holds the URLs of the apple auth endpoints used by a client.
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrInvalidBaseURL = errors.New("base url must be an absolute url")
+)
+
+// Endpoints are the URLs of the apple auth endpoints.
+// Empty URLs fall back to the apple endpoints.
+type Endpoints struct {
+	// Authorization endpoint the browser is sent to, defaults to AUTHORIZE_URL
+	Authorize string
+
+	// Token validation endpoint, defaults to VALIDATION_URL
+	Token string
+
+	// Token revocation endpoint, defaults to REVOKE_URL
+	Revoke string
+
+	// Public keys endpoint, defaults to KEYS_URL
+	Keys string
+
+	// User migration endpoint, defaults to MIGRATION_URL
+	Migration string
+}
+
+// Returns the apple endpoints
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		Authorize: AUTHORIZE_URL,
+		Token:     VALIDATION_URL,
+		Revoke:    REVOKE_URL,
+		Keys:      KEYS_URL,
+		Migration: MIGRATION_URL,
+	}
+}
+
+// Returns the endpoints under given base URL, with the paths of apple endpoints.
+// Use it to point a client at a local stand-in like authtest.Server.
+func EndpointsFromBaseURL(baseURL string) (Endpoints, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return Endpoints{}, err
+	}
+
+	if base.Scheme == "" || base.Host == "" {
+		return Endpoints{}, ErrInvalidBaseURL
+	}
+
+	return Endpoints{
+		Authorize: base.String() + "/auth/authorize",
+		Token:     base.String() + "/auth/token",
+		Revoke:    base.String() + "/auth/revoke",
+		Keys:      base.String() + "/auth/keys",
+		Migration: base.String() + "/auth/usermigrationinfo",
+	}, nil
+}
+
+// withDefaults fills the empty URLs with the apple endpoints
+func (e Endpoints) withDefaults() Endpoints {
+	defaults := DefaultEndpoints()
+
+	if e.Authorize == "" {
+		e.Authorize = defaults.Authorize
+	}
+
+	if e.Token == "" {
+		e.Token = defaults.Token
+	}
+
+	if e.Revoke == "" {
+		e.Revoke = defaults.Revoke
+	}
+
+	if e.Keys == "" {
+		e.Keys = defaults.Keys
+	}
+
+	if e.Migration == "" {
+		e.Migration = defaults.Migration
+	}
+
+	return e
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointsFromBaseURL(t *testing.T) {
+	got, err := EndpointsFromBaseURL("http://127.0.0.1:8080/")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Endpoints{
+		Authorize: "http://127.0.0.1:8080/auth/authorize",
+		Token:     "http://127.0.0.1:8080/auth/token",
+		Revoke:    "http://127.0.0.1:8080/auth/revoke",
+		Keys:      "http://127.0.0.1:8080/auth/keys",
+		Migration: "http://127.0.0.1:8080/auth/usermigrationinfo",
+	}, got)
+
+	_, err = EndpointsFromBaseURL("localhost")
+	assert.Equal(t, ErrInvalidBaseURL, err)
+}
+
+func TestUseEndpoints(t *testing.T) {
+	vReq, err := WithPEMKey(&http.Client{}, "1234567890", "com.example.app", "abc123def4", testSecretKey(t),
+		UseEndpoints(Endpoints{Keys: "http://127.0.0.1/keys"}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1/keys", vReq.Keys.URL)
+	assert.Equal(t, VALIDATION_URL, vReq.endpoints().Token)
+}
+
+func TestKeySet__endpoints(t *testing.T) {
+	server := newKeysServer(t, &testRSAKey.PublicKey, testKeyID)
+	vReq := &Request{
+		ClientID:   "com.example.app",
+		HttpClient: server.Client(),
+		Endpoints:  Endpoints{Keys: server.URL},
+	}
+
+	keys := vReq.keySet()
+	assert.Equal(t, server.URL, keys.URL)
+	assert.Same(t, keys, vReq.keySet())
+
+	// id tokens of struct literal requests are verified with the keys of the endpoint
+	resp := &TokenResponse{
+		IDToken: signIDToken(t, testRSAKey, testKeyID, testIDTokenClaims()),
+		Claims:  &Claims{ClientID: vReq.ClientID, Keys: vReq.keySet()},
+	}
+	id, err := resp.UniqueID()
+	assert.Nil(t, err)
+	assert.Equal(t, "123456", id)
+
+	assert.Same(t, getDefaultKeySet(), (&Request{}).keySet())
+}
@@ -0,0 +1,137 @@
+// errors contains the errors returned by the apple auth endpoints.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/retry"
+)
+
+// Maximum size of an error body read from apple
+const maxErrorBodySize = 64 << 10
+
+// list of errors, to be compared with errors.Is
+var (
+	ErrInvalidRequest       = &APIError{Code: InvalidRequest}
+	ErrInvalidClient        = &APIError{Code: InvalidClient}
+	ErrInvalidGrant         = &APIError{Code: InvalidGrant}
+	ErrUnauthorizedClient   = &APIError{Code: UnauthorizedClient}
+	ErrUnsupportedGrantType = &APIError{Code: UnsupportedGrantType}
+	ErrInvalidScope         = &APIError{Code: InvalidScope}
+	ErrUnsupportedTokenType = &APIError{Code: UnsupportedTokenType}
+
+	// Matches any error with 5xx status from apple
+	ErrServerError = &APIError{StatusCode: http.StatusInternalServerError}
+)
+
+// APIError is the error response of an apple auth endpoint
+type APIError struct {
+	// The OAuth error code like invalid_grant.
+	// Empty when apple did not send a JSON error.
+	Code string
+
+	// The error_description sent by apple, if any
+	Description string
+
+	// The HTTP status of the response
+	StatusCode int
+
+	// The response body when it is not a JSON error
+	Body string
+
+	// The delay apple asked to wait before sending the request again, if any
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		body := strings.TrimSpace(e.Body)
+		if body == "" {
+			return fmt.Sprintf("apple responded with status %d", e.StatusCode)
+		}
+		return fmt.Sprintf("apple responded with status %d: %s", e.StatusCode, body)
+	}
+
+	if e.Description != "" {
+		return errorMessage(e.Code) + " (" + e.Description + ")"
+	}
+
+	return errorMessage(e.Code)
+}
+
+// Is reports whether target is a sentinel error matching e,
+// by OAuth error code or, for ErrServerError, by 5xx status
+func (e *APIError) Is(target error) bool {
+	if target == ErrServerError {
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+
+	t, ok := target.(*APIError)
+	if !ok || t.Code == "" {
+		return false
+	}
+
+	return t.Code == e.Code
+}
+
+// Retryable reports whether the request may succeed when sent again.
+// Apple server errors and rate limiting are temporary, OAuth errors are not.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// readErrorResponse reads the error of a non 200 response.
+// Bodies which are not a JSON error are kept as is.
+func readErrorResponse(response *http.Response) error {
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+	if err != nil {
+		return err
+	}
+
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error == "" {
+		return &APIError{
+			StatusCode: response.StatusCode,
+			Body:       string(body),
+			RetryAfter: retry.RetryAfter(response.Header),
+		}
+	}
+
+	apiErr := errorResponse(errResp)
+	apiErr.StatusCode = response.StatusCode
+	apiErr.RetryAfter = retry.RetryAfter(response.Header)
+
+	return apiErr
+}
+
+// retryable marks err to be sent again by the retry policy when the request may succeed then.
+// Requests which are not idempotent, like code validations, are only sent again
+// when they did not reach apple or were rate limited.
+// Their server errors are marked as failures, so that they still open the breaker.
+func retryable(err error, idempotent bool) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode == http.StatusTooManyRequests || (idempotent && apiErr.Retryable()) {
+			return retry.Retryable(err, apiErr.RetryAfter)
+		}
+
+		// not sent again, but counted by the breaker
+		if apiErr.StatusCode >= http.StatusInternalServerError {
+			return retry.Failed(err)
+		}
+		return err
+	}
+
+	if retry.NotSent(err) || (idempotent && retry.Temporary(err)) {
+		return retry.Retryable(err, 0)
+	}
+
+	return err
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func errorHTTPResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestReadErrorResponse(t *testing.T) {
+	err := readErrorResponse(errorHTTPResponse(http.StatusBadRequest, `{"error":"invalid_grant","error_description":"The code has expired or has been revoked."}`))
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, InvalidGrant, apiErr.Code)
+	assert.Equal(t, "The code has expired or has been revoked.", apiErr.Description)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.False(t, apiErr.Retryable())
+	assert.True(t, errors.Is(err, ErrInvalidGrant))
+	assert.False(t, errors.Is(err, ErrServerError))
+}
+
+func TestReadErrorResponse__notJSON(t *testing.T) {
+	err := readErrorResponse(errorHTTPResponse(http.StatusBadGateway, "<html>Bad Gateway</html>"))
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "", apiErr.Code)
+	assert.Equal(t, "apple responded with status 502: <html>Bad Gateway</html>", err.Error())
+	assert.True(t, apiErr.Retryable())
+	assert.True(t, errors.Is(err, ErrServerError))
+	assert.False(t, errors.Is(err, ErrInvalidGrant))
+}
+
+func TestReadErrorResponse__tooManyRequests(t *testing.T) {
+	err := readErrorResponse(errorHTTPResponse(http.StatusTooManyRequests, ""))
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "apple responded with status 429", err.Error())
+	assert.True(t, apiErr.Retryable())
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int32
+	statuses := []int{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if len(statuses) > 0 {
+			status := statuses[0]
+			statuses = statuses[1:]
+			w.Header().Set("retry-after", "0")
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"access_token":"access-token","expires_in":3600,"token_type":"bearer"}`))
+	})
+
+	req, err := WithPEMKey(&handlerHTTPClient{handler: handler}, "1234567890", "com.example.app", "abc123def4",
+		testSecretKey(t), UseRetryPolicy(&retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	assert.Nil(t, err)
+
+	// refresh tokens are sent again on server errors
+	statuses = []int{http.StatusServiceUnavailable, http.StatusBadGateway}
+	resp, err := req.ValidateRefreshToken(context.Background(), "refresh-token")
+	assert.Nil(t, err)
+	assert.Equal(t, "access-token", resp.AccessToken)
+	assert.Equal(t, int32(3), atomic.SwapInt32(&calls, 0))
+
+	// codes are not, apple may have used them already
+	statuses = []int{http.StatusServiceUnavailable}
+	_, err = req.ValidateCode(context.Background(), "auth-code")
+	assert.ErrorIs(t, err, ErrServerError)
+	assert.Equal(t, int32(1), atomic.SwapInt32(&calls, 0))
+
+	// unless they were rate limited
+	statuses = []int{http.StatusTooManyRequests}
+	_, err = req.ValidateCode(context.Background(), "auth-code")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.SwapInt32(&calls, 0))
+}
+
+func TestRetryPolicy__breaker(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	breaker := retry.NewBreaker(2, time.Minute)
+	req, err := WithPEMKey(&handlerHTTPClient{handler: handler}, "1234567890", "com.example.app", "abc123def4",
+		testSecretKey(t), UseRetryPolicy(&retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, Breaker: breaker}))
+	assert.Nil(t, err)
+
+	// server errors of codes are not sent again, but open the circuit
+	for i := 0; i < 2; i++ {
+		_, err = req.ValidateCode(context.Background(), "auth-code")
+		assert.ErrorIs(t, err, ErrServerError)
+	}
+	assert.True(t, breaker.Open())
+
+	_, err = req.ValidateCode(context.Background(), "auth-code")
+	assert.Equal(t, retry.ErrCircuitOpen, err)
+}
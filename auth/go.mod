@@ -3,7 +3,9 @@ module github.com/canopas/apple-sdk-go/auth
 go 1.18
 
 require (
-	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/canopas/apple-sdk-go/applejson v0.1.0
+	github.com/canopas/apple-sdk-go/observe v0.1.0
+	github.com/canopas/apple-sdk-go/retry v0.1.0
 	github.com/golang-jwt/jwt/v4 v4.4.2
 	github.com/stretchr/testify v1.8.1
 )
@@ -0,0 +1,70 @@
+// hooks reports the calls to apple to the observability hooks of the request.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/canopas/apple-sdk-go/observe"
+)
+
+// Operations of the calls reported to hooks
+const (
+	OperationValidateCode         = "validate_code"
+	OperationValidateRefreshToken = "validate_refresh_token"
+	OperationClientCredentials    = "client_credentials"
+	OperationRevoke               = "revoke"
+	OperationMigration            = "migration"
+)
+
+// send calls attempt with the retry policy and reports the call to the hooks.
+// Failures of attempt are sent again when retryable allows it.
+func (req *Request) send(ctx context.Context, operation, endpoint string, idempotent bool, attempt func(ctx context.Context) error) error {
+	ctx, end := observe.Start(ctx, req.Hooks, &observe.Call{
+		Service:   observe.ServiceAuth,
+		Operation: operation,
+		Endpoint:  endpoint,
+	})
+
+	attempts, err := req.Retry.Do(ctx, func(int) error {
+		return retryable(attempt(ctx), idempotent)
+	})
+
+	// the secret may be signed by a revoked key, the next request signs a new one
+	if errors.Is(err, ErrInvalidClient) && req.SecretCache != nil {
+		req.SecretCache.Invalidate()
+	}
+
+	end(callResult(attempts, err))
+
+	return err
+}
+
+// callResult returns the result reported to hooks, with the status and code of apple errors
+func callResult(attempts int, err error) *observe.Result {
+	result := &observe.Result{Attempts: attempts, Err: err}
+
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		result.StatusCode = http.StatusOK
+	case errors.As(err, &apiErr):
+		result.StatusCode = apiErr.StatusCode
+		result.AppleCode = apiErr.Code
+	}
+
+	return result
+}
+
+// tokenOperation returns the operation of a token request of grantType
+func tokenOperation(grantType string) string {
+	switch grantType {
+	case authGrantType:
+		return OperationValidateCode
+	case refreshTokenGrantType:
+		return OperationValidateRefreshToken
+	default:
+		return OperationClientCredentials
+	}
+}
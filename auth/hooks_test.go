@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/canopas/apple-sdk-go/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHooks struct {
+	calls   []observe.Call
+	results []observe.Result
+}
+
+func (h *recordingHooks) Start(ctx context.Context, call *observe.Call) context.Context {
+	h.calls = append(h.calls, *call)
+	return ctx
+}
+
+func (h *recordingHooks) End(ctx context.Context, call *observe.Call, result *observe.Result) {
+	h.results = append(h.results, *result)
+}
+
+func TestHooks(t *testing.T) {
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+	})
+
+	hooks := &recordingHooks{}
+	req, err := WithPEMKey(&handlerHTTPClient{handler: handler}, "1234567890", "com.example.app", "abc123def4",
+		testSecretKey(t), UseHooks(hooks), UseRetryPolicy(&retry.Policy{BaseDelay: time.Millisecond}))
+	assert.Nil(t, err)
+
+	_, err = req.ValidateRefreshToken(context.Background(), "refresh-token")
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+
+	assert.Equal(t, []observe.Call{{
+		Service:   observe.ServiceAuth,
+		Operation: OperationValidateRefreshToken,
+		Endpoint:  VALIDATION_URL,
+	}}, hooks.calls)
+
+	result := hooks.results[0]
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	assert.Equal(t, InvalidGrant, result.AppleCode)
+	assert.Equal(t, 1, result.Retries())
+
+	_, err = New(UseHooks(nil))
+	assert.ErrorIs(t, err, ErrNilHooks)
+}
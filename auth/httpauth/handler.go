@@ -0,0 +1,404 @@
+// Package httpauth provides net/http handlers for the sign in with apple web flow:
+// redirect to apple, callback, code validation, user mapping and session.
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/auth"
+)
+
+const (
+	// Names of the cookies holding the pending authorization and the session
+	DEFAULT_STATE_COOKIE   = "apple_auth_state"
+	DEFAULT_SESSION_COOKIE = "apple_auth_session"
+
+	// Time the user has to sign in after the login redirect
+	DEFAULT_STATE_LIFETIME = 10 * time.Minute
+
+	// Lifetime of the sessions created by the callback
+	DEFAULT_SESSION_LIFETIME = 24 * time.Hour
+)
+
+var (
+	ErrNilRequest      = errors.New("auth request is nil")
+	ErrMissingRedirect = errors.New("redirect uri is required")
+	ErrNilStore        = errors.New("store is nil")
+	ErrNilUserMapper   = errors.New("user mapper is nil")
+	ErrNilErrorHandler = errors.New("error handler is nil")
+	ErrInvalidLifetime = errors.New("lifetime must be positive")
+	ErrMissingState    = errors.New("callback has no authorization cookie")
+	ErrEmptyUserID     = errors.New("user mapper returned an empty user id")
+	ErrInsecureScopes  = errors.New("insecure cookies can not be used with scopes, the form post of apple needs a secure cookie")
+)
+
+// Identity is the verified apple user of a callback
+type Identity struct {
+	Claims *auth.IDTokenClaims
+
+	// Name and email sent on the first sign in only, nil otherwise.
+	User *auth.CallbackUser
+
+	Token *auth.TokenResponse
+}
+
+// UserMapper maps the verified apple user to the user of the application,
+// creating it on the first sign in, and returns its identifier.
+type UserMapper func(ctx context.Context, identity *Identity) (string, error)
+
+// ErrorHandler writes the response of a failed login or callback
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// Option configures a Handler when it is created
+type Option func(h *Handler) error
+
+// Handler runs the web flow for one client (Services ID) and redirect URI.
+// Mount Login on the login path and Callback on the path of the redirect URI.
+type Handler struct {
+	Request     *auth.Request
+	RedirectURI string
+	Scopes      []string
+
+	States   StateStore
+	Sessions SessionStore
+	MapUser  UserMapper
+	OnError  ErrorHandler
+
+	// Where the callback sends the browser once signed in, defaults to "/"
+	SuccessURL string
+
+	StateCookie     string
+	SessionCookie   string
+	StateLifetime   time.Duration
+	SessionLifetime time.Duration
+
+	// Sends cookies over plain http too, for local development only.
+	// Requires no scopes: the form post of apple only carries SameSite=None cookies, which must be secure.
+	InsecureCookies bool
+
+	now func() time.Time
+}
+
+type sessionContextKey struct{}
+
+// Returns new handler validating codes with req for redirectURI.
+// By default it asks for name and email, keeps states and sessions in memory,
+// and uses the apple user identifier as user id.
+func New(req *auth.Request, redirectURI string, opts ...Option) (*Handler, error) {
+	if req == nil {
+		return nil, ErrNilRequest
+	}
+
+	if redirectURI == "" {
+		return nil, ErrMissingRedirect
+	}
+
+	h := &Handler{
+		Request:         req,
+		RedirectURI:     redirectURI,
+		Scopes:          []string{auth.ScopeName, auth.ScopeEmail},
+		States:          NewMemoryStateStore(),
+		Sessions:        NewMemorySessionStore(),
+		MapUser:         subjectUserMapper,
+		OnError:         defaultErrorHandler,
+		SuccessURL:      "/",
+		StateCookie:     DEFAULT_STATE_COOKIE,
+		SessionCookie:   DEFAULT_SESSION_COOKIE,
+		StateLifetime:   DEFAULT_STATE_LIFETIME,
+		SessionLifetime: DEFAULT_SESSION_LIFETIME,
+		now:             time.Now,
+	}
+
+	for _, opt := range opts {
+		if err := opt(h); err != nil {
+			return nil, err
+		}
+	}
+
+	// the state cookie would not be sent with the callback and every login would fail
+	if h.InsecureCookies && len(h.Scopes) > 0 {
+		return nil, ErrInsecureScopes
+	}
+
+	return h, nil
+}
+
+// UseScopes sets the user information to ask for, none to skip the first sign in form post
+func UseScopes(scopes ...string) Option {
+	return func(h *Handler) error {
+		h.Scopes = scopes
+		return nil
+	}
+}
+
+// UseStateStore sets the store of pending authorizations, shared by all instances
+func UseStateStore(store StateStore) Option {
+	return func(h *Handler) error {
+		if store == nil {
+			return ErrNilStore
+		}
+
+		h.States = store
+		return nil
+	}
+}
+
+// UseSessionStore sets the store of sessions, shared by all instances
+func UseSessionStore(store SessionStore) Option {
+	return func(h *Handler) error {
+		if store == nil {
+			return ErrNilStore
+		}
+
+		h.Sessions = store
+		return nil
+	}
+}
+
+// UseUserMapper sets the hook mapping the apple user to the user of the application
+func UseUserMapper(mapper UserMapper) Option {
+	return func(h *Handler) error {
+		if mapper == nil {
+			return ErrNilUserMapper
+		}
+
+		h.MapUser = mapper
+		return nil
+	}
+}
+
+// UseErrorHandler sets the response of failed logins and callbacks
+func UseErrorHandler(handler ErrorHandler) Option {
+	return func(h *Handler) error {
+		if handler == nil {
+			return ErrNilErrorHandler
+		}
+
+		h.OnError = handler
+		return nil
+	}
+}
+
+// UseSuccessURL sets where the callback sends the browser once signed in
+func UseSuccessURL(successURL string) Option {
+	return func(h *Handler) error {
+		h.SuccessURL = successURL
+		return nil
+	}
+}
+
+// UseSessionLifetime sets the lifetime of the sessions
+func UseSessionLifetime(lifetime time.Duration) Option {
+	return func(h *Handler) error {
+		if lifetime <= 0 {
+			return ErrInvalidLifetime
+		}
+
+		h.SessionLifetime = lifetime
+		return nil
+	}
+}
+
+// UseInsecureCookies sends cookies over plain http, for local development only.
+// Use it with UseScopes() as apple posts the callback cross-site when scopes are asked.
+func UseInsecureCookies() Option {
+	return func(h *Handler) error {
+		h.InsecureCookies = true
+		return nil
+	}
+}
+
+// Login creates an authorization and redirects the browser to apple
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	authorization, err := auth.NewAuthorization(h.RedirectURI, h.Scopes...)
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	authorizeURL, err := h.Request.AuthorizationURL(authorization)
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	id, err := auth.RandomValue()
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	expiresAt := h.now().Add(h.StateLifetime)
+	if err := h.States.Put(r.Context(), id, authorization, expiresAt); err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	// the form post of apple is a cross-site request, so the cookie needs SameSite=None
+	http.SetCookie(w, h.cookie(h.StateCookie, id, expiresAt, http.SameSiteNoneMode))
+	http.Redirect(w, r, authorizeURL, http.StatusFound)
+}
+
+// Callback verifies the authorization response, maps the user,
+// creates the session and redirects the browser to SuccessURL
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	stateCookie, cookieErr := r.Cookie(h.StateCookie)
+
+	// the authorization is used once, whatever the outcome, cancelled sign ins included
+	var authorization *auth.Authorization
+	var takeErr error
+	if cookieErr == nil {
+		http.SetCookie(w, h.cookie(h.StateCookie, "", time.Unix(0, 0), http.SameSiteNoneMode))
+		authorization, takeErr = h.States.Take(r.Context(), stateCookie.Value)
+	}
+
+	callback, err := auth.ParseCallback(r)
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	if cookieErr != nil {
+		h.OnError(w, r, ErrMissingState)
+		return
+	}
+
+	if takeErr != nil {
+		h.OnError(w, r, takeErr)
+		return
+	}
+
+	resp, claims, err := h.Request.VerifyCallback(r.Context(), authorization, callback)
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	userID, err := h.MapUser(r.Context(), &Identity{Claims: claims, User: callback.User, Token: resp})
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	if userID == "" {
+		h.OnError(w, r, ErrEmptyUserID)
+		return
+	}
+
+	now := h.now()
+	session := &Session{
+		UserID:       userID,
+		Sub:          claims.Subject,
+		Email:        claims.Email,
+		RefreshToken: resp.RefreshToken,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(h.SessionLifetime),
+	}
+
+	id, err := auth.RandomValue()
+	if err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	if err := h.Sessions.Save(r.Context(), id, session); err != nil {
+		h.OnError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, h.cookie(h.SessionCookie, id, session.ExpiresAt, http.SameSiteLaxMode))
+	http.Redirect(w, r, h.SuccessURL, http.StatusSeeOther)
+}
+
+// Logout deletes the session and redirects the browser to "/"
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(h.SessionCookie); err == nil {
+		if err := h.Sessions.Delete(r.Context(), cookie.Value); err != nil {
+			h.OnError(w, r, err)
+			return
+		}
+	}
+
+	http.SetCookie(w, h.cookie(h.SessionCookie, "", time.Unix(0, 0), http.SameSiteLaxMode))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Session returns the session of the request cookie
+func (h *Handler) Session(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(h.SessionCookie)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	return h.Sessions.Get(r.Context(), cookie.Value)
+}
+
+// RequireSession serves next with the session in the request context,
+// and responds 401 Unauthorized to requests without a valid session
+func (h *Handler) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := h.Session(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+	})
+}
+
+// SessionFromContext returns the session added by RequireSession
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionContextKey{}).(*Session)
+	return session, ok
+}
+
+func (h *Handler) cookie(name, value string, expiresAt time.Time, sameSite http.SameSite) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   !h.InsecureCookies,
+		SameSite: sameSite,
+	}
+
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+
+	// browsers reject SameSite=None without Secure, Lax cookies are still sent
+	// with the callback when apple redirects the browser to it (no scopes)
+	if h.InsecureCookies && sameSite == http.SameSiteNoneMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+
+	return cookie
+}
+
+// subjectUserMapper uses the apple user identifier as user id
+func subjectUserMapper(ctx context.Context, identity *Identity) (string, error) {
+	return identity.Claims.Subject, nil
+}
+
+// defaultErrorHandler responds 401 to cancelled sign ins, 400 to invalid callbacks
+// and 500 to other failures, without the error details
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+
+	var callbackErr *auth.CallbackError
+	switch {
+	case errors.As(err, &callbackErr):
+		status = http.StatusUnauthorized
+	case errors.Is(err, auth.ErrMissingCode), errors.Is(err, auth.ErrInvalidCallback),
+		errors.Is(err, auth.ErrInvalidUserJSON), errors.Is(err, auth.ErrStateMismatch),
+		errors.Is(err, ErrMissingState), errors.Is(err, ErrStateNotFound),
+		errors.Is(err, auth.ErrInvalidGrant):
+		status = http.StatusBadRequest
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,219 @@
+package httpauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/canopas/apple-sdk-go/auth"
+	"github.com/canopas/apple-sdk-go/auth/authtest"
+	"github.com/canopas/apple-sdk-go/auth/httpauth"
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectURI = "https://example.com/auth/callback"
+
+func newHandler(t *testing.T, server *authtest.Server, opts ...httpauth.Option) *httpauth.Handler {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	req, err := auth.WithPrivateKey(server.Client(), "1234567890", server.ClientID, "abc123def4", key,
+		auth.UseEndpoints(server.Endpoints()))
+	assert.Nil(t, err)
+
+	h, err := httpauth.New(req, redirectURI, opts...)
+	assert.Nil(t, err)
+
+	return h
+}
+
+// login runs the login handler and returns the authorize URL query and the state cookie
+func login(t *testing.T, h *httpauth.Handler) (url.Values, *http.Cookie) {
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	location, err := url.Parse(rec.Header().Get("location"))
+	assert.Nil(t, err)
+	assert.Equal(t, "/auth/authorize", location.Path)
+
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	return location.Query(), cookies[0]
+}
+
+// callback posts the authorization response to the callback handler
+func callback(h *httpauth.Handler, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/auth/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("content-type", auth.CONTENT_TYPE)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Callback(rec, r)
+
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	server := authtest.NewServer("com.example.web")
+	defer server.Close()
+
+	var identity *httpauth.Identity
+	h := newHandler(t, server, httpauth.UseSuccessURL("/home"),
+		httpauth.UseUserMapper(func(ctx context.Context, i *httpauth.Identity) (string, error) {
+			identity = i
+			return "user-42", nil
+		}))
+
+	query, stateCookie := login(t, h)
+	assert.Equal(t, "com.example.web", query.Get("client_id"))
+	assert.Equal(t, redirectURI, query.Get("redirect_uri"))
+	assert.Equal(t, "form_post", query.Get("response_mode"))
+	assert.Equal(t, http.SameSiteNoneMode, stateCookie.SameSite)
+	assert.True(t, stateCookie.Secure)
+
+	user := auth.User{ID: "001234.abcd", Email: "john.doe@privaterelay.appleid.com"}
+	form := url.Values{
+		"code":  {server.IssueCode(user, query.Get("nonce"))},
+		"state": {query.Get("state")},
+		"user":  {`{"name":{"firstName":"John","lastName":"Doe"},"email":"john.doe@privaterelay.appleid.com"}`},
+	}
+
+	rec := callback(h, form, stateCookie)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/home", rec.Header().Get("location"))
+	assert.Equal(t, "John", identity.User.Name.FirstName)
+	assert.Equal(t, user.ID, identity.Claims.Subject)
+
+	var sessionCookie *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == httpauth.DEFAULT_SESSION_COOKIE {
+			sessionCookie = cookie
+		}
+	}
+	assert.NotNil(t, sessionCookie)
+
+	protected := h.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := httpauth.SessionFromContext(r.Context())
+		assert.True(t, ok)
+		w.Write([]byte(session.UserID + " " + session.Email))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/me", nil)
+	r.AddCookie(sessionCookie)
+	rec = httptest.NewRecorder()
+	protected.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user-42 john.doe@privaterelay.appleid.com", rec.Body.String())
+
+	// the authorization can not be used twice
+	rec = callback(h, form, stateCookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// logout deletes the session
+	r = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	r.AddCookie(sessionCookie)
+	h.Logout(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest(http.MethodGet, "/me", nil)
+	r.AddCookie(sessionCookie)
+	rec = httptest.NewRecorder()
+	protected.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestHandler__invalidCallbacks(t *testing.T) {
+	server := authtest.NewServer("com.example.web")
+	defer server.Close()
+
+	h := newHandler(t, server)
+	user := auth.User{ID: "001234.abcd"}
+
+	query, stateCookie := login(t, h)
+	rec := callback(h, url.Values{
+		"code":  {server.IssueCode(user, query.Get("nonce"))},
+		"state": {"forged-state"},
+	}, stateCookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	query, _ = login(t, h)
+	rec = callback(h, url.Values{
+		"code":  {server.IssueCode(user, query.Get("nonce"))},
+		"state": {query.Get("state")},
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	query, stateCookie = login(t, h)
+	rec = callback(h, url.Values{
+		"error": {auth.UserCancelledAuthorize},
+		"state": {query.Get("state")},
+	}, stateCookie)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// the authorization of a cancelled sign in can not be used afterwards
+	rec = callback(h, url.Values{
+		"code":  {server.IssueCode(user, query.Get("nonce"))},
+		"state": {query.Get("state")},
+	}, stateCookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler__insecureCookies(t *testing.T) {
+	server := authtest.NewServer("com.example.web")
+	defer server.Close()
+
+	h := newHandler(t, server, httpauth.UseScopes(), httpauth.UseInsecureCookies())
+
+	// without scopes, apple redirects the browser to the callback and the Lax cookie is sent
+	query, stateCookie := login(t, h)
+	assert.Equal(t, "query", query.Get("response_mode"))
+	assert.Equal(t, http.SameSiteLaxMode, stateCookie.SameSite)
+	assert.False(t, stateCookie.Secure)
+
+	user := auth.User{ID: "001234.abcd"}
+	form := url.Values{
+		"code":  {server.IssueCode(user, query.Get("nonce"))},
+		"state": {query.Get("state")},
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/callback?"+form.Encode(), nil)
+	r.AddCookie(stateCookie)
+	rec := httptest.NewRecorder()
+	h.Callback(rec, r)
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	for _, cookie := range rec.Result().Cookies() {
+		assert.False(t, cookie.Secure)
+	}
+
+	// the form post of apple is cross-site, the Lax cookie would never be sent back
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	req, err := auth.WithPrivateKey(server.Client(), "1234567890", server.ClientID, "abc123def4", key)
+	assert.Nil(t, err)
+
+	_, err = httpauth.New(req, redirectURI, httpauth.UseInsecureCookies())
+	assert.Equal(t, httpauth.ErrInsecureScopes, err)
+}
+
+func TestNew__invalid(t *testing.T) {
+	_, err := httpauth.New(nil, redirectURI)
+	assert.Equal(t, httpauth.ErrNilRequest, err)
+
+	_, err = httpauth.New(&auth.Request{}, "")
+	assert.Equal(t, httpauth.ErrMissingRedirect, err)
+
+	_, err = httpauth.New(&auth.Request{}, redirectURI, httpauth.UseSessionStore(nil))
+	assert.Equal(t, httpauth.ErrNilStore, err)
+}
@@ -0,0 +1,158 @@
+// store keeps the pending authorizations and the sessions of signed in users.
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/auth"
+)
+
+var (
+	ErrStateNotFound   = errors.New("authorization is unknown, expired or already used")
+	ErrSessionNotFound = errors.New("session is unknown or expired")
+)
+
+// StateStore keeps the authorization of a login until its callback.
+// Take must remove the authorization, so that each is used once.
+type StateStore interface {
+	Put(ctx context.Context, id string, authorization *auth.Authorization, expiresAt time.Time) error
+	Take(ctx context.Context, id string) (*auth.Authorization, error)
+}
+
+// SessionStore keeps the sessions of signed in users.
+// Get returns ErrSessionNotFound for unknown and expired sessions.
+type SessionStore interface {
+	Save(ctx context.Context, id string, session *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Session is a signed in user
+type Session struct {
+	// Identifier of the user in the application, as returned by the UserMapper.
+	UserID string `json:"user_id"`
+
+	// Unique identifier of the user for the apple team.
+	Sub string `json:"sub"`
+
+	// Email of the user, real or private relay address. Empty if not shared.
+	Email string `json:"email,omitempty"`
+
+	// Refresh token to validate or revoke the apple session later.
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type pendingAuthorization struct {
+	authorization *auth.Authorization
+	expiresAt     time.Time
+}
+
+// MemoryStateStore keeps authorizations in memory, for a single instance.
+// It is safe for concurrent use.
+type MemoryStateStore struct {
+	// Returns current time, defaults to time.Now
+	Now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingAuthorization
+}
+
+// Returns new empty in-memory state store
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{pending: make(map[string]pendingAuthorization)}
+}
+
+func (s *MemoryStateStore) Put(ctx context.Context, id string, authorization *auth.Authorization, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop expired authorizations of abandoned logins
+	now := clock(s.Now)
+	for key, p := range s.pending {
+		if !now.Before(p.expiresAt) {
+			delete(s.pending, key)
+		}
+	}
+
+	s.pending[id] = pendingAuthorization{authorization: authorization, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStateStore) Take(ctx context.Context, id string) (*auth.Authorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.pending[id]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	delete(s.pending, id)
+
+	if !clock(s.Now).Before(p.expiresAt) {
+		return nil, ErrStateNotFound
+	}
+
+	return p.authorization, nil
+}
+
+// MemorySessionStore keeps sessions in memory, for a single instance.
+// It is safe for concurrent use.
+type MemorySessionStore struct {
+	// Returns current time, defaults to time.Now
+	Now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// Returns new empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, id string, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	if !clock(s.Now).Before(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return nil, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+func clock(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
@@ -0,0 +1,49 @@
+package httpauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStateStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStateStore()
+	store.Now = func() time.Time { return now }
+
+	authorization := &auth.Authorization{State: "state-123"}
+	assert.Nil(t, store.Put(context.Background(), "id", authorization, now.Add(time.Minute)))
+
+	got, err := store.Take(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Equal(t, authorization, got)
+
+	_, err = store.Take(context.Background(), "id")
+	assert.Equal(t, ErrStateNotFound, err)
+
+	assert.Nil(t, store.Put(context.Background(), "expired", authorization, now.Add(time.Minute)))
+	now = now.Add(time.Minute)
+
+	_, err = store.Take(context.Background(), "expired")
+	assert.Equal(t, ErrStateNotFound, err)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemorySessionStore()
+	store.Now = func() time.Time { return now }
+
+	session := &Session{UserID: "user-42", ExpiresAt: now.Add(time.Hour)}
+	assert.Nil(t, store.Save(context.Background(), "id", session))
+
+	got, err := store.Get(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Equal(t, session, got)
+
+	now = now.Add(time.Hour)
+	_, err = store.Get(context.Background(), "id")
+	assert.Equal(t, ErrSessionNotFound, err)
+}
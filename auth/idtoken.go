@@ -0,0 +1,141 @@
+// idtoken checks the nonce and hash claims of the identity token.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrNonceMissing            = errors.New("id token has no nonce claim")
+	ErrNonceMismatch           = errors.New("id token nonce does not match the expected nonce")
+	ErrAccessTokenHashMismatch = errors.New("id token at_hash does not match the access token")
+	ErrCodeHashMismatch        = errors.New("id token c_hash does not match the authorization code")
+	ErrEmptyNonce              = errors.New("expected nonce is empty")
+)
+
+// IDTokenOption adds a check of the identity token claims
+type IDTokenOption func(*idTokenChecks)
+
+type idTokenChecks struct {
+	checkNonce bool
+	nonce      string
+	checkCode  bool
+	code       string
+}
+
+// WithNonce checks the nonce claim equals nonce,
+// as sent in the authorization request of the web flow.
+// An empty nonce, typically lost with the session, fails the check with ErrEmptyNonce.
+func WithNonce(nonce string) IDTokenOption {
+	return func(c *idTokenChecks) {
+		c.checkNonce = true
+		c.nonce = nonce
+	}
+}
+
+// WithSHA256Nonce checks the nonce claim equals the hex encoded SHA-256 of rawNonce,
+// as sent by apps which hash the nonce before passing it to the authorization request.
+// An empty rawNonce fails the check with ErrEmptyNonce.
+func WithSHA256Nonce(rawNonce string) IDTokenOption {
+	return func(c *idTokenChecks) {
+		c.checkNonce = true
+		if rawNonce == "" {
+			c.nonce = ""
+			return
+		}
+
+		sum := sha256.Sum256([]byte(rawNonce))
+		c.nonce = hex.EncodeToString(sum[:])
+	}
+}
+
+// WithCode checks the c_hash claim, when present, against the authorization code
+func WithCode(code string) IDTokenOption {
+	return func(c *idTokenChecks) {
+		c.checkCode = true
+		c.code = code
+	}
+}
+
+// VerifyIDToken verifies the identity token of resp and runs the given checks.
+// The at_hash claim, when present, is always checked against the access token.
+func (resp *TokenResponse) VerifyIDToken(opts ...IDTokenOption) (*IDTokenClaims, error) {
+	return resp.VerifyIDTokenContext(context.Background(), opts...)
+}
+
+// VerifyIDTokenContext is VerifyIDToken with ctx bounding the fetch of the public keys
+func (resp *TokenResponse) VerifyIDTokenContext(ctx context.Context, opts ...IDTokenOption) (*IDTokenClaims, error) {
+	claims, err := resp.getClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resp.checkIDToken(claims, opts...); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (resp *TokenResponse) checkIDToken(claims *IDTokenClaims, opts ...IDTokenOption) error {
+	var checks idTokenChecks
+	for _, opt := range opts {
+		opt(&checks)
+	}
+
+	if checks.checkNonce {
+		if checks.nonce == "" {
+			return ErrEmptyNonce
+		}
+
+		if err := checkNonce(claims, checks.nonce); err != nil {
+			return err
+		}
+	}
+
+	if claims.AtHash != "" && resp.AccessToken != "" {
+		if !equalHash(claims.AtHash, resp.AccessToken) {
+			return ErrAccessTokenHashMismatch
+		}
+	}
+
+	if claims.CHash != "" && checks.checkCode {
+		if !equalHash(claims.CHash, checks.code) {
+			return ErrCodeHashMismatch
+		}
+	}
+
+	return nil
+}
+
+// checkNonce compares the nonce claim, which can only be missing
+// when the platform reports nonce_supported as false
+func checkNonce(claims *IDTokenClaims, expected string) error {
+	if claims.Nonce == "" {
+		if claims.NonceSupported != nil && !*claims.NonceSupported {
+			return nil
+		}
+		return ErrNonceMissing
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(expected)) != 1 {
+		return ErrNonceMismatch
+	}
+
+	return nil
+}
+
+// equalHash compares claim to the base64url encoded left half of the SHA-256 of value
+func equalHash(claim, value string) bool {
+	return subtle.ConstantTimeCompare([]byte(claim), []byte(tokenHash(value))) == 1
+}
+
+func tokenHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
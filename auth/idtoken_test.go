@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTokenResponse(t *testing.T, claims jwt.MapClaims) *TokenResponse {
+	return &TokenResponse{
+		AccessToken: "access-token",
+		IDToken:     signIDToken(t, testRSAKey, testKeyID, claims),
+		Claims:      testClaims(t),
+	}
+}
+
+func TestVerifyIDToken__nonce(t *testing.T) {
+	claims := testIDTokenClaims()
+	claims["nonce"] = "nonce-123"
+	resp := testTokenResponse(t, claims)
+
+	_, err := resp.VerifyIDToken(WithNonce("nonce-123"))
+	assert.Nil(t, err)
+
+	_, err = resp.VerifyIDToken(WithNonce("other"))
+	assert.Equal(t, ErrNonceMismatch, err)
+}
+
+func TestVerifyIDToken__emptyNonce(t *testing.T) {
+	claims := testIDTokenClaims()
+	claims["nonce"] = "nonce-123"
+	resp := testTokenResponse(t, claims)
+
+	// a nonce lost with the session does not skip the check
+	_, err := resp.VerifyIDToken(WithNonce(""))
+	assert.Equal(t, ErrEmptyNonce, err)
+
+	_, err = resp.VerifyIDToken(WithSHA256Nonce(""))
+	assert.Equal(t, ErrEmptyNonce, err)
+
+	claims["nonce_supported"] = false
+	_, err = testTokenResponse(t, claims).VerifyIDToken(WithNonce(""))
+	assert.Equal(t, ErrEmptyNonce, err)
+}
+
+func TestVerifyIDToken__sha256Nonce(t *testing.T) {
+	claims := testIDTokenClaims()
+	// SHA-256 of "raw-nonce"
+	claims["nonce"] = "2c5d107938053a2275f022c153c9a71f65ee07754b8bca543ee97a0c3cc66990"
+	resp := testTokenResponse(t, claims)
+
+	_, err := resp.VerifyIDToken(WithSHA256Nonce("raw-nonce"))
+	assert.Nil(t, err)
+
+	_, err = resp.VerifyIDToken(WithSHA256Nonce("other"))
+	assert.Equal(t, ErrNonceMismatch, err)
+}
+
+func TestVerifyIDToken__nonceMissing(t *testing.T) {
+	resp := testTokenResponse(t, testIDTokenClaims())
+
+	_, err := resp.VerifyIDToken(WithNonce("nonce-123"))
+	assert.Equal(t, ErrNonceMissing, err)
+
+	claims := testIDTokenClaims()
+	claims["nonce_supported"] = false
+	resp = testTokenResponse(t, claims)
+
+	_, err = resp.VerifyIDToken(WithNonce("nonce-123"))
+	assert.Nil(t, err)
+}
+
+func TestVerifyIDToken__accessTokenHash(t *testing.T) {
+	claims := testIDTokenClaims()
+	claims["at_hash"] = tokenHash("access-token")
+	resp := testTokenResponse(t, claims)
+
+	_, err := resp.VerifyIDToken()
+	assert.Nil(t, err)
+
+	resp.AccessToken = "other-token"
+	_, err = resp.GetUser()
+	assert.Equal(t, ErrAccessTokenHashMismatch, err)
+}
+
+func TestVerifyIDToken__codeHash(t *testing.T) {
+	claims := testIDTokenClaims()
+	claims["c_hash"] = tokenHash("auth-code")
+	resp := testTokenResponse(t, claims)
+
+	_, err := resp.VerifyIDToken(WithCode("auth-code"))
+	assert.Nil(t, err)
+
+	_, err = resp.VerifyIDToken(WithCode("other-code"))
+	assert.Equal(t, ErrCodeHashMismatch, err)
+}
@@ -0,0 +1,411 @@
+// keys fetches the Apple public keys used to verify identity tokens.
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KEYS_URL = "https://appleid.apple.com/auth/keys"
+
+	// Lifetime of keys when the keys response has no max-age
+	DEFAULT_KEYS_MAX_AGE = time.Hour
+
+	// Minimum time between two fetches of the keys
+	MIN_KEYS_REFRESH_INTERVAL = time.Minute
+)
+
+var (
+	ErrUnknownKeyID  = errors.New("no apple public key matches the token kid")
+	ErrInvalidJWK    = errors.New("apple public key is malformed or unsupported")
+	ErrKeysFetchFail = errors.New("failed to fetch apple public keys")
+)
+
+// JWK is a single JSON Web Key returned by Apple.
+// https://developer.apple.com/documentation/sign_in_with_apple/jwkset/keys
+type JWK struct {
+	// The encryption algorithm used to encrypt the token.
+	Alg string `json:"alg"`
+
+	// The exponent value for the RSA public key.
+	E string `json:"e"`
+
+	// A 10-character identifier key, obtained from your developer account.
+	Kid string `json:"kid"`
+
+	// The key type parameter setting. You must set to "RSA".
+	Kty string `json:"kty"`
+
+	// The modulus value for the RSA public key.
+	N string `json:"n"`
+
+	// The intended use for the public key.
+	Use string `json:"use"`
+}
+
+// JWKSet is the set of keys returned by the keys endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet downloads and caches Apple's public keys by kid.
+// Keys are kept for the max-age of the keys response and fetched again
+// once when a token carries an unknown kid. It is safe for concurrent use.
+type KeySet struct {
+	HttpClient httpClient
+
+	// URL of the keys endpoint, defaults to KEYS_URL
+	URL string
+
+	// Lifetime of the keys when response has no Cache-Control max-age,
+	// defaults to DEFAULT_KEYS_MAX_AGE
+	DefaultMaxAge time.Duration
+
+	// Minimum time between two fetches, which limits the fetches
+	// triggered by tokens with unknown kid, defaults to MIN_KEYS_REFRESH_INTERVAL
+	MinRefreshInterval time.Duration
+
+	// Reports failed background refreshes, nothing is logged when nil
+	Logger Logger
+
+	// serializes fetches, so concurrent misses share one request
+	fetchMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	attemptedAt time.Time
+	expiresAt   time.Time
+
+	// error of the last fetch, nil once keys are fetched
+	fetchErr error
+
+	// returns current time, replaced in tests
+	now func() time.Time
+}
+
+var (
+	defaultKeySet     *KeySet
+	defaultKeySetOnce sync.Once
+)
+
+// Returns new key set using given client
+func NewKeySet(client httpClient) *KeySet {
+	return &KeySet{
+		HttpClient: client,
+		URL:        KEYS_URL,
+	}
+}
+
+// getDefaultKeySet returns the shared key set used when none is configured
+func getDefaultKeySet() *KeySet {
+	defaultKeySetOnce.Do(func() {
+		defaultKeySet = NewKeySet(&http.Client{
+			Timeout: 10 * time.Second,
+		})
+	})
+	return defaultKeySet
+}
+
+// PublicKey returns the public key with the given kid.
+// Keys are fetched on first use, after they expire, and whenever kid
+// is not cached unless keys were fetched within MinRefreshInterval.
+// Expired keys are still used if they can not be fetched again.
+// Within MinRefreshInterval of a failed fetch, the error of that fetch is returned.
+func (ks *KeySet) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	key, ok, expired := ks.lookup(kid)
+	if ok && !expired {
+		return key, nil
+	}
+
+	err := ks.refresh(ctx)
+
+	if key, ok, _ := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, ErrUnknownKeyID
+}
+
+// Refresh downloads the keys and replaces the cached ones.
+// Fetches which fail because ctx is done are not counted as attempts,
+// so that they do not delay the fetches of other callers.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	keys, maxAge, err := ks.fetchKeys(ctx)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.attemptedAt = ks.clock()
+	ks.fetchErr = err
+	if err != nil {
+		return err
+	}
+
+	if maxAge < ks.minRefreshInterval() {
+		maxAge = ks.minRefreshInterval()
+	}
+
+	ks.keys = keys
+	ks.expiresAt = ks.clock().Add(maxAge)
+
+	return nil
+}
+
+// fetchKeys downloads the keys and returns them by kid with their max-age
+func (ks *KeySet) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	set, maxAge, err := ks.fetch(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, err := set.publicKeys()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return keys, maxAge, nil
+}
+
+// StartRefresh refreshes the keys in background shortly before they expire,
+// so that token verification does not wait for the keys endpoint.
+// Refreshing stops when ctx is done.
+func (ks *KeySet) StartRefresh(ctx context.Context) {
+	go func() {
+		for {
+			timer := time.NewTimer(ks.nextRefresh())
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if err := ks.Refresh(ctx); err != nil && ks.Logger != nil && ctx.Err() == nil {
+				ks.Logger.Printf("auth: refreshing apple public keys: %v", err)
+			}
+		}
+	}()
+}
+
+// refresh fetches the keys unless a fetch was attempted within MinRefreshInterval,
+// in which case it returns the error of that fetch
+func (ks *KeySet) refresh(ctx context.Context) error {
+	ks.fetchMu.Lock()
+	defer ks.fetchMu.Unlock()
+
+	ks.mu.RLock()
+	attemptedAt, fetchErr := ks.attemptedAt, ks.fetchErr
+	ks.mu.RUnlock()
+
+	if !attemptedAt.IsZero() && ks.clock().Sub(attemptedAt) < ks.minRefreshInterval() {
+		return fetchErr
+	}
+
+	return ks.Refresh(ctx)
+}
+
+// nextRefresh returns the wait before the next background refresh
+func (ks *KeySet) nextRefresh() time.Duration {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.keys == nil {
+		if ks.attemptedAt.IsZero() {
+			return 0
+		}
+		return ks.minRefreshInterval()
+	}
+
+	wait := ks.expiresAt.Sub(ks.clock()) - ks.minRefreshInterval()
+	if wait < ks.minRefreshInterval() {
+		wait = ks.minRefreshInterval()
+	}
+
+	return wait
+}
+
+func (ks *KeySet) lookup(kid string) (key *rsa.PublicKey, ok bool, expired bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok = ks.keys[kid]
+	return key, ok, !ks.clock().Before(ks.expiresAt)
+}
+
+func (ks *KeySet) clock() time.Time {
+	if ks.now != nil {
+		return ks.now()
+	}
+	return time.Now()
+}
+
+func (ks *KeySet) defaultMaxAge() time.Duration {
+	if ks.DefaultMaxAge > 0 {
+		return ks.DefaultMaxAge
+	}
+	return DEFAULT_KEYS_MAX_AGE
+}
+
+func (ks *KeySet) minRefreshInterval() time.Duration {
+	if ks.MinRefreshInterval > 0 {
+		return ks.MinRefreshInterval
+	}
+	return MIN_KEYS_REFRESH_INTERVAL
+}
+
+// fetch downloads the keys and returns them with their max-age
+func (ks *KeySet) fetch(ctx context.Context) (*JWKSet, time.Duration, error) {
+	url := ks.URL
+	if url == "" {
+		url = KEYS_URL
+	}
+
+	newReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	newReq.Header.Add("accept", ACCEPT)
+	newReq.Header.Add("user-agent", USER_AGENT)
+
+	response, err := ks.HttpClient.Do(newReq)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%w: status %d", ErrKeysFetchFail, response.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return nil, 0, err
+	}
+
+	return &set, ks.maxAge(response.Header), nil
+}
+
+// maxAge reads the max-age directive of the Cache-Control header
+func (ks *KeySet) maxAge(header http.Header) time.Duration {
+	for _, directive := range strings.Split(header.Get("cache-control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err != nil || seconds < 0 {
+			break
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	return ks.defaultMaxAge()
+}
+
+// publicKeys converts the RSA keys of the set into a kid keyed map
+func (set *JWKSet) publicKeys() (map[string]*rsa.PublicKey, error) {
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// PublicKey decodes the modulus and exponent into an RSA public key
+func (jwk *JWK) PublicKey() (*rsa.PublicKey, error) {
+	if jwk.Kty != "RSA" {
+		return nil, ErrInvalidJWK
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil || len(n) == 0 {
+		return nil, ErrInvalidJWK
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, ErrInvalidJWK
+	}
+
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: exponent,
+	}, nil
+}
+
+// StartKeyRefresh refreshes in background the keys used to verify
+// the identity tokens of req responses, until ctx is done.
+func (req *Request) StartKeyRefresh(ctx context.Context) {
+	req.keySet().StartRefresh(ctx)
+}
+
+// keySet returns the keys of req, the keys of Endpoints.Keys,
+// or the shared default key set for the apple endpoint
+func (req *Request) keySet() *KeySet {
+	if req.Keys != nil {
+		return req.Keys
+	}
+
+	url := req.endpoints().Keys
+	if url == KEYS_URL {
+		return getDefaultKeySet()
+	}
+
+	if keys, ok := req.endpointKeys.Load().(*KeySet); ok && keys.URL == url {
+		return keys
+	}
+
+	client := req.HttpClient
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	keys := NewKeySet(client)
+	keys.URL = url
+	keys.Logger = req.Logger
+	keys.now = req.now
+	req.endpointKeys.Store(keys)
+
+	return keys
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKeyID = "W6WcOKB"
+
+var testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// Serves the JWKS of given key like the apple keys endpoint
+func newKeysServer(t *testing.T, key *rsa.PublicKey, kid string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{testJWK(key, kid)}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testJWK(key *rsa.PublicKey, kid string) JWK {
+	return JWK{
+		Alg: "RS256",
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		Kid: kid,
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		Use: "sig",
+	}
+}
+
+func testIDTokenClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   AUDIENCE,
+		"aud":   "com.example.app",
+		"sub":   "123456",
+		"email": "john.doe@gmail.com",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return signed
+}
+
+func testClaims(t *testing.T) *Claims {
+	server := newKeysServer(t, &testRSAKey.PublicKey, testKeyID)
+	keys := NewKeySet(server.Client())
+	keys.URL = server.URL
+
+	return &Claims{ClientID: "com.example.app", Keys: keys}
+}
+
+func TestGetClaims(t *testing.T) {
+	idToken := signIDToken(t, testRSAKey, testKeyID, testIDTokenClaims())
+
+	got, err := testClaims(t).GetClaims(idToken)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "123456", got.Subject)
+}
+
+func TestGetClaims__invalidSignature(t *testing.T) {
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idToken := signIDToken(t, otherKey, testKeyID, testIDTokenClaims())
+
+	_, err := testClaims(t).GetClaims(idToken)
+
+	assert.Equal(t, rsa.ErrVerification, err)
+}
+
+func TestGetClaims__unknownKeyID(t *testing.T) {
+	idToken := signIDToken(t, testRSAKey, "unknown", testIDTokenClaims())
+
+	_, err := testClaims(t).GetClaims(idToken)
+
+	assert.Equal(t, ErrUnknownKeyID, err)
+}
+
+func TestGetClaimsContext__canceled(t *testing.T) {
+	idToken := signIDToken(t, testRSAKey, testKeyID, testIDTokenClaims())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the keys are fetched with the context of the caller
+	_, err := testClaims(t).GetClaimsContext(ctx, idToken)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	resp := &TokenResponse{IDToken: idToken, Claims: testClaims(t)}
+	_, err = resp.GetUserContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGetClaims__unsignedToken(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, testIDTokenClaims())
+	idToken, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	_, err := testClaims(t).GetClaims(idToken)
+
+	assert.Equal(t, ErrInvalidSigningMethod, err)
+}
+
+func TestGetClaims__invalidClaims(t *testing.T) {
+	tests := map[string]struct {
+		claim string
+		value interface{}
+		err   error
+	}{
+		"issuer":    {"iss", "https://example.com", ErrInvalidIssuer},
+		"audience":  {"aud", "com.other.app", ErrInvalidAudience},
+		"expired":   {"exp", time.Now().Add(-2 * time.Minute).Unix(), ErrTokenExpired},
+		"issued at": {"iat", time.Now().Add(time.Hour).Unix(), ErrInvalidIssuedAt},
+	}
+
+	claims := testClaims(t)
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tokenClaims := testIDTokenClaims()
+			tokenClaims[test.claim] = test.value
+
+			_, err := claims.GetClaims(signIDToken(t, testRSAKey, testKeyID, tokenClaims))
+
+			assert.Equal(t, test.err, err)
+		})
+	}
+}
+
+func TestGetClaims__clockSkew(t *testing.T) {
+	claims := testClaims(t)
+
+	// apple clock a few seconds ahead of the server
+	tokenClaims := testIDTokenClaims()
+	tokenClaims["iat"] = time.Now().Add(2 * time.Second).Unix()
+	_, err := claims.GetClaims(signIDToken(t, testRSAKey, testKeyID, tokenClaims))
+	assert.Nil(t, err)
+
+	// token expired a few seconds ago on the server clock
+	tokenClaims = testIDTokenClaims()
+	tokenClaims["exp"] = time.Now().Add(-2 * time.Second).Unix()
+	_, err = claims.GetClaims(signIDToken(t, testRSAKey, testKeyID, tokenClaims))
+	assert.Nil(t, err)
+
+	// the clock of the request is used
+	claims.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = claims.GetClaims(signIDToken(t, testRSAKey, testKeyID, testIDTokenClaims()))
+	assert.Equal(t, ErrTokenExpired, err)
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	jwk := testJWK(&testRSAKey.PublicKey, testKeyID)
+
+	got, err := jwk.PublicKey()
+
+	assert.Nil(t, err)
+	assert.Equal(t, testRSAKey.PublicKey, *got)
+}
+
+// Serves the JWKS of given keys and counts the fetches
+type countingKeysServer struct {
+	*httptest.Server
+	fetches int32
+	jwks    atomic.Value
+}
+
+func newCountingKeysServer(t *testing.T, cacheControl string, jwks ...JWK) *countingKeysServer {
+	server := &countingKeysServer{}
+	server.jwks.Store(jwks)
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&server.fetches, 1)
+		w.Header().Set("cache-control", cacheControl)
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: server.jwks.Load().([]JWK)})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *countingKeysServer) keySet(now func() time.Time) *KeySet {
+	keys := NewKeySet(s.Client())
+	keys.URL = s.URL
+	keys.now = now
+	return keys
+}
+
+func TestKeySetCachesKeys(t *testing.T) {
+	server := newCountingKeysServer(t, "max-age=3600", testJWK(&testRSAKey.PublicKey, testKeyID))
+	now := time.Now()
+	keys := server.keySet(func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		_, err := keys.PublicKey(context.Background(), testKeyID)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.fetches))
+
+	// keys expire after max-age
+	now = now.Add(time.Hour)
+	_, err := keys.PublicKey(context.Background(), testKeyID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.fetches))
+}
+
+func TestKeySetRateLimitsUnknownKeyID(t *testing.T) {
+	server := newCountingKeysServer(t, "max-age=3600", testJWK(&testRSAKey.PublicKey, testKeyID))
+	now := time.Now()
+	keys := server.keySet(func() time.Time { return now })
+
+	for i := 0; i < 10; i++ {
+		_, err := keys.PublicKey(context.Background(), "forged")
+		assert.Equal(t, ErrUnknownKeyID, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.fetches))
+}
+
+func TestKeySetRotation(t *testing.T) {
+	server := newCountingKeysServer(t, "max-age=3600", testJWK(&testRSAKey.PublicKey, testKeyID))
+	now := time.Now()
+	keys := server.keySet(func() time.Time { return now })
+
+	_, err := keys.PublicKey(context.Background(), testKeyID)
+	assert.Nil(t, err)
+
+	rotatedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server.jwks.Store([]JWK{testJWK(&rotatedKey.PublicKey, "rotated")})
+
+	// new kid is fetched once the refresh interval passed
+	now = now.Add(MIN_KEYS_REFRESH_INTERVAL)
+	got, err := keys.PublicKey(context.Background(), "rotated")
+
+	assert.Nil(t, err)
+	assert.Equal(t, rotatedKey.PublicKey, *got)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.fetches))
+}
+
+func TestKeySetStartRefresh(t *testing.T) {
+	server := newCountingKeysServer(t, "max-age=3600", testJWK(&testRSAKey.PublicKey, testKeyID))
+	keys := server.keySet(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keys.StartRefresh(ctx)
+
+	assert.Eventually(t, func() bool {
+		_, ok, _ := keys.lookup(testKeyID)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestKeySetMaxAge(t *testing.T) {
+	keys := NewKeySet(nil)
+
+	tests := map[string]time.Duration{
+		"public, max-age=600": 10 * time.Minute,
+		"max-age=0":           0,
+		"no-cache":            DEFAULT_KEYS_MAX_AGE,
+		"max-age=abc":         DEFAULT_KEYS_MAX_AGE,
+		"":                    DEFAULT_KEYS_MAX_AGE,
+	}
+
+	for cacheControl, expected := range tests {
+		header := http.Header{}
+		header.Set("cache-control", cacheControl)
+		assert.Equal(t, expected, keys.maxAge(header), cacheControl)
+	}
+}
+
+func TestKeySetFailedFetches(t *testing.T) {
+	var fail int32 = 1
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{testJWK(&testRSAKey.PublicKey, testKeyID)}})
+	}))
+	t.Cleanup(server.Close)
+
+	now := time.Now()
+	keys := NewKeySet(server.Client())
+	keys.URL = server.URL
+	keys.now = func() time.Time { return now }
+
+	// a cancelled caller does not delay the fetch of the next one
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := keys.PublicKey(ctx, testKeyID)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the error of a failed fetch is reported until the next fetch
+	for i := 0; i < 2; i++ {
+		_, err = keys.PublicKey(context.Background(), testKeyID)
+		assert.ErrorIs(t, err, ErrKeysFetchFail)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	atomic.StoreInt32(&fail, 0)
+	now = now.Add(MIN_KEYS_REFRESH_INTERVAL)
+	_, err = keys.PublicKey(context.Background(), testKeyID)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
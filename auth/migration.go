@@ -0,0 +1,368 @@
+// migration handles the transfer of users when an app moves between teams.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MIGRATION_URL = "https://appleid.apple.com/auth/usermigrationinfo"
+
+	// Number of concurrent requests of batch migrations when none is given
+	DEFAULT_MIGRATION_CONCURRENCY = 10
+
+	// The access token is renewed this long before it expires, at most a tenth of its lifetime
+	MIGRATION_TOKEN_SKEW = time.Minute
+)
+
+var (
+	// Grant type and scope of the access token used for user migration
+	clientCredentialsGrantType string = "client_credentials"
+	userMigrationScope         string = "user.migration"
+
+	// Error code of a bearer token which is expired or revoked
+	invalidTokenCode string = "invalid_token"
+
+	ErrEmptyTransferSub = errors.New("apple returned an empty transfer identifier")
+	ErrEmptyMigratedSub = errors.New("apple returned an empty user identifier")
+)
+
+// Migration generates and exchanges transfer identifiers for the team of Request.
+// Use the migration of the sending team to generate transfer identifiers,
+// and the migration of the recipient team to exchange them for new user identifiers.
+type Migration struct {
+	Request *Request
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	fetch     *tokenFetch
+}
+
+// tokenFetch is an access token request in flight, done is closed once it completes
+type tokenFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// MigratedUser is the user of the recipient team for a transfer identifier
+type MigratedUser struct {
+	// The unique identifier of the user for the recipient team.
+	ID string `json:"sub"`
+
+	// The email of the user, either the real or the private relay address of the recipient team.
+	Email string `json:"email,omitempty"`
+
+	// Whether the email is the private relay address.
+	IsPrivateEmail bool `json:"is_private_email,omitempty"`
+}
+
+// TransferResult is the result of a transfer identifier generation for a user
+type TransferResult struct {
+	Sub         string
+	TransferSub string
+	Err         error
+}
+
+// ExchangeResult is the result of a transfer identifier exchange
+type ExchangeResult struct {
+	TransferSub string
+	User        *MigratedUser
+	Err         error
+}
+
+type migrationResponse struct {
+	TransferSub string `json:"transfer_sub"`
+	MigratedUser
+}
+
+// Returns new migration for the team of given request
+func NewMigration(req *Request) *Migration {
+	return &Migration{Request: req}
+}
+
+// AccessToken returns the client credentials access token with user.migration scope.
+// Token is reused until it expires, and fetched once for concurrent callers.
+// Callers waiting for the fetch of another one return as soon as their ctx is done.
+func (m *Migration) AccessToken(ctx context.Context) (string, error) {
+	for {
+		m.mu.Lock()
+		if m.token != "" && time.Now().Before(m.expiresAt) {
+			token := m.token
+			m.mu.Unlock()
+			return token, nil
+		}
+
+		fetch := m.fetch
+		if fetch == nil {
+			fetch = &tokenFetch{done: make(chan struct{})}
+			m.fetch = fetch
+			m.mu.Unlock()
+
+			return m.fetchToken(ctx, fetch)
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-fetch.done:
+		}
+
+		// the fetch of a cancelled caller is started again by a waiting one
+		if fetch.err != nil && !errors.Is(fetch.err, context.Canceled) && !errors.Is(fetch.err, context.DeadlineExceeded) {
+			return "", fetch.err
+		}
+	}
+}
+
+// fetchToken requests a new access token and completes fetch with the outcome
+func (m *Migration) fetchToken(ctx context.Context, fetch *tokenFetch) (token string, err error) {
+	var expiresAt time.Time
+	defer func() {
+		m.mu.Lock()
+		if err == nil {
+			m.token = token
+			m.expiresAt = expiresAt
+		}
+		m.fetch = nil
+		fetch.err = err
+		m.mu.Unlock()
+		close(fetch.done)
+	}()
+
+	formData, err := m.Request.newFormData("", clientCredentialsGrantType, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	formData.Add("scope", userMigrationScope)
+
+	resp, err := m.Request.doRequest(ctx, formData)
+	if err != nil {
+		return "", err
+	}
+
+	// renew early, so that token does not expire in flight
+	lifetime := time.Duration(resp.ExpiresIn) * time.Second
+	skew := MIGRATION_TOKEN_SKEW
+	if skew > lifetime/10 {
+		skew = lifetime / 10
+	}
+
+	expiresAt = time.Now().Add(lifetime - skew)
+	return resp.AccessToken, nil
+}
+
+// resetToken drops the cached access token if it is still token
+func (m *Migration) resetToken(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == token {
+		m.token = ""
+		m.expiresAt = time.Time{}
+	}
+}
+
+// TransferSub generates the transfer identifier of user sub for the recipient team.
+// Call it with the migration of the sending team.
+func (m *Migration) TransferSub(ctx context.Context, sub, recipientTeamID string) (string, error) {
+	formData := url.Values{
+		"sub":    []string{sub},
+		"target": []string{recipientTeamID},
+	}
+
+	resp, err := m.doMigrationRequest(ctx, formData)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.TransferSub == "" {
+		return "", ErrEmptyTransferSub
+	}
+
+	return resp.TransferSub, nil
+}
+
+// ExchangeTransferSub exchanges the transfer identifier for the user of the recipient team.
+// Call it with the migration of the recipient team.
+func (m *Migration) ExchangeTransferSub(ctx context.Context, transferSub string) (*MigratedUser, error) {
+	formData := url.Values{
+		"transfer_sub": []string{transferSub},
+	}
+
+	resp, err := m.doMigrationRequest(ctx, formData)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ID == "" {
+		return nil, ErrEmptyMigratedSub
+	}
+
+	return &resp.MigratedUser, nil
+}
+
+// TransferSubs generates transfer identifiers of subs with at most concurrency requests in flight.
+// Results are in the order of subs, failures are reported per user.
+func (m *Migration) TransferSubs(ctx context.Context, subs []string, recipientTeamID string, concurrency int) []TransferResult {
+	results := make([]TransferResult, len(subs))
+
+	runBatch(ctx, len(subs), concurrency, func(i int) {
+		transferSub, err := m.TransferSub(ctx, subs[i], recipientTeamID)
+		results[i] = TransferResult{Sub: subs[i], TransferSub: transferSub, Err: err}
+	}, func(i int, err error) {
+		results[i] = TransferResult{Sub: subs[i], Err: err}
+	})
+
+	return results
+}
+
+// ExchangeTransferSubs exchanges transfer identifiers with at most concurrency requests in flight.
+// Results are in the order of transferSubs, failures are reported per user.
+func (m *Migration) ExchangeTransferSubs(ctx context.Context, transferSubs []string, concurrency int) []ExchangeResult {
+	results := make([]ExchangeResult, len(transferSubs))
+
+	runBatch(ctx, len(transferSubs), concurrency, func(i int) {
+		user, err := m.ExchangeTransferSub(ctx, transferSubs[i])
+		results[i] = ExchangeResult{TransferSub: transferSubs[i], User: user, Err: err}
+	}, func(i int, err error) {
+		results[i] = ExchangeResult{TransferSub: transferSubs[i], Err: err}
+	})
+
+	return results
+}
+
+// runBatch calls do for each index with at most concurrency calls in flight.
+// Once ctx is done, remaining indexes are passed to skip with the context error.
+func runBatch(ctx context.Context, n, concurrency int, do func(i int), skip func(i int, err error)) {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_MIGRATION_CONCURRENCY
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			skip(i, ctx.Err())
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			skip(i, ctx.Err())
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			do(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// doMigrationRequest sends formData with the access token.
+// A token rejected by apple, expired or revoked early, is fetched again and the request sent once more.
+func (m *Migration) doMigrationRequest(ctx context.Context, formData url.Values) (*migrationResponse, error) {
+	token, err := m.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.sendWithToken(ctx, token, formData)
+	if !tokenRejected(err) {
+		return resp, err
+	}
+
+	m.resetToken(token)
+
+	token, err = m.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.sendWithToken(ctx, token, formData)
+}
+
+// tokenRejected reports whether apple refused the access token of a migration request
+func tokenRejected(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	return apiErr.Code == InvalidClient || apiErr.Code == invalidTokenCode
+}
+
+func (m *Migration) sendWithToken(ctx context.Context, token string, formData url.Values) (*migrationResponse, error) {
+	secretData, err := m.Request.newFormData("", "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range secretData {
+		formData[key] = values
+	}
+
+	var migrationResp *migrationResponse
+	err = m.Request.send(ctx, OperationMigration, m.Request.endpoints().Migration, true, func(ctx context.Context) error {
+		resp, err := m.sendMigrationRequest(ctx, token, formData)
+		if err != nil {
+			return err
+		}
+
+		migrationResp = resp
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationResp, nil
+}
+
+func (m *Migration) sendMigrationRequest(ctx context.Context, token string, formData url.Values) (*migrationResponse, error) {
+	newReq, err := http.NewRequestWithContext(ctx, "POST", m.Request.endpoints().Migration, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	newReq.Header.Add("authorization", "Bearer "+token)
+	newReq.Header.Add("content-type", CONTENT_TYPE)
+	newReq.Header.Add("accept", ACCEPT)
+	newReq.Header.Add("user-agent", USER_AGENT)
+
+	response, err := m.Request.HttpClient.Do(newReq)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, readErrorResponse(response)
+	}
+
+	var migrationResp migrationResponse
+	if err := json.NewDecoder(response.Body).Decode(&migrationResp); err != nil {
+		return nil, err
+	}
+
+	return &migrationResp, nil
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// HTTP client which serves requests with the given handler
+type handlerHTTPClient struct {
+	handler http.Handler
+}
+
+func (c *handlerHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	c.handler.ServeHTTP(recorder, req)
+	return recorder.Result(), nil
+}
+
+// Emulates the token and user migration endpoints of apple
+func migrationHandler(t *testing.T, tokenFetches *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+
+		switch r.URL.String() {
+		case VALIDATION_URL:
+			atomic.AddInt32(tokenFetches, 1)
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "user.migration", r.PostForm.Get("scope"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "migration-token",
+				"expires_in":   3600,
+				"token_type":   "bearer",
+			})
+
+		case MIGRATION_URL:
+			assert.Equal(t, "Bearer migration-token", r.Header.Get("authorization"))
+			assert.NotEmpty(t, r.PostForm.Get("client_secret"))
+
+			if sub := r.PostForm.Get("sub"); sub != "" {
+				assert.Equal(t, "NEWTEAM123", r.PostForm.Get("target"))
+				if sub == "unknown" {
+					w.WriteHeader(http.StatusBadRequest)
+					_ = json.NewEncoder(w).Encode(ErrorResponse{Error: InvalidRequest})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]string{"transfer_sub": "transfer." + sub})
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"sub":              "new." + r.PostForm.Get("transfer_sub"),
+				"email":            "john.doe@privaterelay.appleid.com",
+				"is_private_email": true,
+			})
+
+		default:
+			t.Errorf("unexpected request to %s", r.URL)
+		}
+	})
+}
+
+func testMigration(t *testing.T, tokenFetches *int32) *Migration {
+	vReq := request()
+	vReq.ClientSecret = testSecretKey(t)
+	vReq.HttpClient = &handlerHTTPClient{handler: migrationHandler(t, tokenFetches)}
+	return NewMigration(vReq)
+}
+
+func TestTransferSub(t *testing.T) {
+	var tokenFetches int32
+	migration := testMigration(t, &tokenFetches)
+
+	got, err := migration.TransferSub(context.Background(), "123456", "NEWTEAM123")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "transfer.123456", got)
+}
+
+func TestExchangeTransferSub(t *testing.T) {
+	var tokenFetches int32
+	migration := testMigration(t, &tokenFetches)
+
+	got, err := migration.ExchangeTransferSub(context.Background(), "transfer.123456")
+
+	assert.Nil(t, err)
+	assert.Equal(t, &MigratedUser{
+		ID:             "new.transfer.123456",
+		Email:          "john.doe@privaterelay.appleid.com",
+		IsPrivateEmail: true,
+	}, got)
+}
+
+func TestTransferSubs(t *testing.T) {
+	var tokenFetches int32
+	migration := testMigration(t, &tokenFetches)
+	subs := []string{"1", "2", "unknown", "4", "5"}
+
+	got := migration.TransferSubs(context.Background(), subs, "NEWTEAM123", 2)
+
+	assert.Len(t, got, len(subs))
+	for i, result := range got {
+		assert.Equal(t, subs[i], result.Sub)
+		if result.Sub == "unknown" {
+			assert.Equal(t, InvalidRequestMsg, result.Err.Error())
+			continue
+		}
+		assert.Nil(t, result.Err)
+		assert.Equal(t, "transfer."+subs[i], result.TransferSub)
+	}
+
+	// access token is reused by all requests
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenFetches))
+}
+
+func TestExchangeTransferSubs__canceled(t *testing.T) {
+	var tokenFetches int32
+	migration := testMigration(t, &tokenFetches)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got := migration.ExchangeTransferSubs(ctx, []string{"transfer.1", "transfer.2"}, 1)
+
+	for _, result := range got {
+		assert.Equal(t, context.Canceled, result.Err)
+	}
+}
+
+func TestAccessToken__concurrentFetch(t *testing.T) {
+	var tokenFetches int32
+	started, release := make(chan struct{}), make(chan struct{})
+
+	migration := testMigration(t, &tokenFetches)
+	handler := migration.Request.HttpClient.(*handlerHTTPClient).handler
+	migration.Request.HttpClient = &handlerHTTPClient{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		handler.ServeHTTP(w, r)
+	})}
+
+	fetched := make(chan error, 1)
+	go func() {
+		token, err := migration.AccessToken(context.Background())
+		assert.Equal(t, "migration-token", token)
+		fetched <- err
+	}()
+	<-started
+
+	// a caller waiting for the fetch in flight is freed by its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := migration.AccessToken(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Nil(t, <-fetched)
+
+	token, err := migration.AccessToken(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "migration-token", token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenFetches))
+}
+
+func TestAccessToken__shortLifetime(t *testing.T) {
+	var tokenFetches int32
+	migration := testMigration(t, &tokenFetches)
+	migration.Request.HttpClient = &handlerHTTPClient{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenFetches, 1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "migration-token", "expires_in": 30})
+	})}
+
+	for i := 0; i < 2; i++ {
+		_, err := migration.AccessToken(context.Background())
+		assert.Nil(t, err)
+	}
+
+	// a minute early would renew the token of 30 seconds on every call
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenFetches))
+}
+
+func TestExchangeTransferSub__rejectedToken(t *testing.T) {
+	for _, code := range []string{InvalidClient, "invalid_token"} {
+		var tokenFetches, migrations int32
+		migration := testMigration(t, &tokenFetches)
+		migration.Request.HttpClient = &handlerHTTPClient{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.String() == VALIDATION_URL {
+				fetch := atomic.AddInt32(&tokenFetches, 1)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": fmt.Sprint("token-", fetch), "expires_in": 3600})
+				return
+			}
+
+			atomic.AddInt32(&migrations, 1)
+			if r.Header.Get("authorization") != "Bearer token-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(ErrorResponse{Error: code})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"sub": "new.123456"})
+		})}
+
+		got, err := migration.ExchangeTransferSub(context.Background(), "transfer.123456")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "new.123456", got.ID)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&tokenFetches))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&migrations))
+	}
+
+	// the request is sent again once only
+	var tokenFetches int32
+	migration := testMigration(t, &tokenFetches)
+	migration.Request.HttpClient = &handlerHTTPClient{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == VALIDATION_URL {
+			atomic.AddInt32(&tokenFetches, 1)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "migration-token", "expires_in": 3600})
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Error: InvalidClient})
+	})}
+
+	_, err := migration.ExchangeTransferSub(context.Background(), "transfer.123456")
+
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokenFetches))
+}
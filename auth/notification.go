@@ -0,0 +1,338 @@
+// notification verifies and dispatches the server-to-server notifications of account events.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// Types of the account events
+	EventEmailDisabled  = "email-disabled"
+	EventEmailEnabled   = "email-enabled"
+	EventConsentRevoked = "consent-revoked"
+	EventAccountDelete  = "account-delete"
+
+	// Age after which a notification is rejected as stale
+	DEFAULT_NOTIFICATION_MAX_AGE = time.Hour
+
+	// Allowed clock difference with apple for the iat claim
+	notificationLeeway = time.Minute
+
+	// Maximum size of a notification body
+	maxNotificationSize = 64 << 10
+)
+
+var (
+	ErrStaleNotification    = errors.New("notification is older than the allowed age")
+	ErrReplayedNotification = errors.New("notification was already received")
+	ErrMissingEvent         = errors.New("notification has no events claim")
+)
+
+// Event is the account event of a notification
+// https://developer.apple.com/documentation/sign_in_with_apple/processing_changes_for_sign_in_with_apple_accounts
+type Event struct {
+	// The type of event, like EventAccountDelete.
+	Type string `json:"type"`
+
+	// The unique identifier of the user.
+	Sub string `json:"sub"`
+
+	// The private relay email of the email-disabled and email-enabled events.
+	Email string `json:"email,omitempty"`
+
+	// Whether the email is the private relay address.
+	IsPrivateEmail StringBool `json:"is_private_email,omitempty"`
+
+	// The time of the event in milliseconds since epoch.
+	EventTime int64 `json:"event_time"`
+}
+
+// NotificationClaims are the claims of a notification
+type NotificationClaims struct {
+	jwt.RegisteredClaims
+
+	Events *Event `json:"events"`
+}
+
+// ReplayCache remembers received notifications until they expire.
+// Seen records id and reports whether it was already recorded,
+// Forget removes it, so that a failed notification can be received again.
+type ReplayCache interface {
+	Seen(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+	Forget(ctx context.Context, id string) error
+}
+
+// NotificationParser verifies notifications sent to the client.
+type NotificationParser struct {
+	// ClientID the notification audience must match
+	ClientID string
+
+	// Keys used to verify the notification signature.
+	// Shared default key set is used when nil.
+	Keys *KeySet
+
+	// Age after which notifications are stale, defaults to DEFAULT_NOTIFICATION_MAX_AGE
+	MaxAge time.Duration
+
+	// Received notifications, notifications are not checked for replay when nil
+	Replay ReplayCache
+
+	now func() time.Time
+}
+
+// NotificationHandler receives the notifications at the endpoint registered with apple
+// and calls the callback of the event type. Nil callbacks ignore their events.
+// Notifications with a failed callback are answered with an error so that apple sends them again.
+type NotificationHandler struct {
+	Parser *NotificationParser
+
+	OnEmailDisabled  func(ctx context.Context, event *Event) error
+	OnEmailEnabled   func(ctx context.Context, event *Event) error
+	OnConsentRevoked func(ctx context.Context, event *Event) error
+	OnAccountDelete  func(ctx context.Context, event *Event) error
+}
+
+// notificationBody is the body apple posts to the notification endpoint
+type notificationBody struct {
+	Payload string `json:"payload"`
+}
+
+// Returns new parser for notifications of the client of req,
+// with the keys and clock of req and an in-memory replay cache
+func NewNotificationParser(req *Request) *NotificationParser {
+	replay := NewMemoryReplayCache()
+	replay.Now = req.now
+
+	return &NotificationParser{
+		ClientID: req.ClientID,
+		Keys:     req.keySet(),
+		MaxAge:   DEFAULT_NOTIFICATION_MAX_AGE,
+		Replay:   replay,
+		now:      req.now,
+	}
+}
+
+// Time returns the time of the event
+func (e *Event) Time() time.Time {
+	return time.UnixMilli(e.EventTime)
+}
+
+// UnmarshalJSON decodes the event, which apple sends as a JSON encoded string
+func (e *Event) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+
+		// an empty events claim is reported by verify
+		if s == "" {
+			return nil
+		}
+		data = []byte(s)
+	}
+
+	type event Event
+	return json.Unmarshal(data, (*event)(e))
+}
+
+// Parse verifies the notification payload signature against Apple's public keys,
+// checks iss, aud, iat, the age and replay of the notification, and returns its claims
+func (p *NotificationParser) Parse(ctx context.Context, payload string) (*NotificationClaims, error) {
+	keys := p.Keys
+	if keys == nil {
+		keys = getDefaultKeySet()
+	}
+
+	claims := &NotificationClaims{}
+	if err := parseAppleToken(ctx, payload, claims, keys); err != nil {
+		return nil, err
+	}
+
+	if err := p.verify(claims); err != nil {
+		return nil, err
+	}
+
+	if p.Replay != nil {
+		seen, err := p.Replay.Seen(ctx, replayID(payload, claims), claims.IssuedAt.Add(p.maxAge()))
+		if err != nil {
+			return nil, err
+		}
+
+		if seen {
+			return nil, ErrReplayedNotification
+		}
+	}
+
+	return claims, nil
+}
+
+// verify checks the registered claims and the age of a signature verified notification
+func (p *NotificationParser) verify(claims *NotificationClaims) error {
+	now := p.clock()
+
+	if !claims.VerifyIssuer(AUDIENCE, true) {
+		return ErrInvalidIssuer
+	}
+
+	if p.ClientID == "" || !claims.VerifyAudience(p.ClientID, true) {
+		return ErrInvalidAudience
+	}
+
+	if claims.IssuedAt == nil || claims.IssuedAt.After(now.Add(notificationLeeway)) {
+		return ErrInvalidIssuedAt
+	}
+
+	if now.Sub(claims.IssuedAt.Time) > p.maxAge() {
+		return ErrStaleNotification
+	}
+
+	if claims.ExpiresAt != nil && !claims.VerifyExpiresAt(now, true) {
+		return ErrTokenExpired
+	}
+
+	if claims.Events == nil || claims.Events.Type == "" {
+		return ErrMissingEvent
+	}
+
+	return nil
+}
+
+func (p *NotificationParser) maxAge() time.Duration {
+	if p.MaxAge <= 0 {
+		return DEFAULT_NOTIFICATION_MAX_AGE
+	}
+	return p.MaxAge
+}
+
+func (p *NotificationParser) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// replayID identifies a notification by its jti, or by the hash of the payload without one
+func replayID(payload string, claims *NotificationClaims) string {
+	if claims.ID != "" {
+		return claims.ID
+	}
+
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP verifies the posted notification and calls the callback of its event.
+// Invalid, stale and replayed notifications are answered with 400 Bad Request.
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body notificationBody
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxNotificationSize)).Decode(&body); err != nil || body.Payload == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.Parser.Parse(r.Context(), body.Payload)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Dispatch(r.Context(), claims.Events); err != nil {
+		// forget the notification, apple sends it again
+		if h.Parser.Replay != nil {
+			h.Parser.Replay.Forget(r.Context(), replayID(body.Payload, claims))
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Dispatch calls the callback of the event type, unknown types are ignored
+func (h *NotificationHandler) Dispatch(ctx context.Context, event *Event) error {
+	var callback func(ctx context.Context, event *Event) error
+
+	switch event.Type {
+	case EventEmailDisabled:
+		callback = h.OnEmailDisabled
+	case EventEmailEnabled:
+		callback = h.OnEmailEnabled
+	case EventConsentRevoked:
+		callback = h.OnConsentRevoked
+	case EventAccountDelete:
+		callback = h.OnAccountDelete
+	}
+
+	if callback == nil {
+		return nil
+	}
+
+	return callback(ctx, event)
+}
+
+// MemoryReplayCache keeps received notifications in memory, for a single instance.
+// It is safe for concurrent use.
+type MemoryReplayCache struct {
+	// Returns current time, defaults to time.Now
+	Now func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Returns new empty in-memory replay cache
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{seen: make(map[string]time.Time)}
+}
+
+func (c *MemoryReplayCache) Seen(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+
+	// drop expired notifications, which are rejected as stale anyway
+	for key, expiry := range c.seen {
+		if !now.Before(expiry) {
+			delete(c.seen, key)
+		}
+	}
+
+	if _, ok := c.seen[id]; ok {
+		return true, nil
+	}
+
+	c.seen[id] = expiresAt
+	return false, nil
+}
+
+func (c *MemoryReplayCache) Forget(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.seen, id)
+	return nil
+}
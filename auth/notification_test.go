@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNotificationParser(t *testing.T) *NotificationParser {
+	return &NotificationParser{
+		ClientID: "com.example.app",
+		Keys:     testClaims(t).Keys,
+		Replay:   NewMemoryReplayCache(),
+	}
+}
+
+func testNotification(t *testing.T, jti string, iat time.Time, events string) string {
+	return signIDToken(t, testRSAKey, testKeyID, jwt.MapClaims{
+		"iss":    AUDIENCE,
+		"aud":    "com.example.app",
+		"iat":    iat.Unix(),
+		"jti":    jti,
+		"events": events,
+	})
+}
+
+func TestNotificationParser(t *testing.T) {
+	parser := testNotificationParser(t)
+	payload := testNotification(t, "jti-1", time.Now(),
+		`{"type":"email-disabled","sub":"123456","email":"abc@privaterelay.appleid.com","is_private_email":"true","event_time":1508184845000}`)
+
+	claims, err := parser.Parse(context.Background(), payload)
+	assert.Nil(t, err)
+	assert.Equal(t, &Event{
+		Type:           EventEmailDisabled,
+		Sub:            "123456",
+		Email:          "abc@privaterelay.appleid.com",
+		IsPrivateEmail: true,
+		EventTime:      1508184845000,
+	}, claims.Events)
+	assert.Equal(t, time.Unix(1508184845, 0), claims.Events.Time())
+
+	_, err = parser.Parse(context.Background(), payload)
+	assert.Equal(t, ErrReplayedNotification, err)
+}
+
+func TestNotificationParser__invalid(t *testing.T) {
+	parser := testNotificationParser(t)
+	events := `{"type":"account-delete","sub":"123456","event_time":1508184845000}`
+
+	_, err := parser.Parse(context.Background(), testNotification(t, "jti-1", time.Now().Add(-2*time.Hour), events))
+	assert.Equal(t, ErrStaleNotification, err)
+
+	_, err = parser.Parse(context.Background(), testNotification(t, "jti-2", time.Now().Add(time.Hour), events))
+	assert.Equal(t, ErrInvalidIssuedAt, err)
+
+	_, err = parser.Parse(context.Background(), testNotification(t, "jti-3", time.Now(), ""))
+	assert.Equal(t, ErrMissingEvent, err)
+
+	parser.ClientID = "com.example.other"
+	_, err = parser.Parse(context.Background(), testNotification(t, "jti-4", time.Now(), events))
+	assert.Equal(t, ErrInvalidAudience, err)
+}
+
+func TestNotificationHandler(t *testing.T) {
+	var deleted []string
+	fail := true
+
+	handler := &NotificationHandler{
+		Parser: testNotificationParser(t),
+		OnAccountDelete: func(ctx context.Context, event *Event) error {
+			if fail {
+				fail = false
+				return errors.New("database is down")
+			}
+			deleted = append(deleted, event.Sub)
+			return nil
+		},
+	}
+
+	post := func(payload string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/apple/notifications",
+			strings.NewReader(`{"payload":"`+payload+`"}`)))
+		return rec.Code
+	}
+
+	payload := testNotification(t, "jti-1", time.Now(), `{"type":"account-delete","sub":"123456","event_time":1508184845000}`)
+
+	// failed notifications can be sent again
+	assert.Equal(t, http.StatusInternalServerError, post(payload))
+	assert.Equal(t, http.StatusOK, post(payload))
+	assert.Equal(t, []string{"123456"}, deleted)
+
+	assert.Equal(t, http.StatusBadRequest, post(payload))
+
+	// events without callback are ignored
+	assert.Equal(t, http.StatusOK, post(testNotification(t, "jti-2", time.Now(), `{"type":"consent-revoked","sub":"123456"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, post("not-a-jwt"))
+}
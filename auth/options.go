@@ -0,0 +1,310 @@
+// options configures the requests created by New and the other constructors.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/canopas/apple-sdk-go/retry"
+)
+
+var (
+	ErrInvalidTeamID   = errors.New("team id must be the 10-character App ID prefix")
+	ErrInvalidKeyID    = errors.New("key id must be the 10-character identifier of the private key")
+	ErrInvalidClientID = errors.New("client id must be a bundle id or a Services ID like com.example.app")
+	ErrMissingKey      = errors.New("a private key, key source or signer is required")
+	ErrNilHTTPClient   = errors.New("http client is nil")
+	ErrNilClock        = errors.New("clock is nil")
+	ErrNilLogger       = errors.New("logger is nil")
+	ErrNilRetryPolicy  = errors.New("retry policy is nil")
+	ErrNilHooks        = errors.New("hooks are nil")
+)
+
+var (
+	identifierRegexp = regexp.MustCompile(`^[A-Za-z0-9]{10}$`)
+	clientIDRegexp   = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+)
+
+// Option configures a Request when it is created
+type Option func(req *Request) error
+
+// Logger reports failures of background work, like key refreshes.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ConfigError is the list of all configuration errors found by New
+type ConfigError struct {
+	Errors []error
+}
+
+func (e *ConfigError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "invalid auth configuration: " + strings.Join(messages, "; ")
+}
+
+// Is reports whether any of the configuration errors matches target
+func (e *ConfigError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns new request configured by given options.
+// Team id, client id, key id and a key are required, the http client
+// defaults to one with 10 seconds timeout. All options are validated
+// before returning, errors are reported together as *ConfigError.
+func New(opts ...Option) (*Request, error) {
+	req := &Request{}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, req.validate()...)
+	if len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+
+	req.setDefaults()
+
+	return req, nil
+}
+
+// UseCredentials sets the team id, client id and key id of the request
+func UseCredentials(teamID, clientID, keyID string) Option {
+	return func(req *Request) error {
+		req.TeamID = teamID
+		req.ClientID = clientID
+		req.KeyID = keyID
+		return nil
+	}
+}
+
+// UseHTTPClient sets the client used for all calls to apple
+func UseHTTPClient(client httpClient) Option {
+	return func(req *Request) error {
+		if client == nil {
+			return ErrNilHTTPClient
+		}
+
+		req.HttpClient = client
+		return nil
+	}
+}
+
+// UseEndpoints sets the URLs of the auth endpoints, empty URLs stay the apple ones
+func UseEndpoints(endpoints Endpoints) Option {
+	return func(req *Request) error {
+		req.Endpoints = endpoints
+		return nil
+	}
+}
+
+// UseBaseURL points all auth endpoints at given base URL
+func UseBaseURL(baseURL string) Option {
+	return func(req *Request) error {
+		endpoints, err := EndpointsFromBaseURL(baseURL)
+		if err != nil {
+			return err
+		}
+
+		req.Endpoints = endpoints
+		return nil
+	}
+}
+
+// UseKeySource sets the source of the private key signing the client secret
+func UseKeySource(source KeySource) Option {
+	return func(req *Request) error {
+		if source == nil {
+			return ErrNilKeySource
+		}
+
+		req.KeySource = source
+		return nil
+	}
+}
+
+// UsePEMKey sets the PEM encoded private key (.p8 file content)
+func UsePEMKey(pemKey []byte) Option {
+	return func(req *Request) error {
+		source, err := KeyFromPEM(pemKey)
+		if err != nil {
+			return err
+		}
+
+		req.KeySource = source
+		return nil
+	}
+}
+
+// UseKeyFile sets the private key file (.p8)
+func UseKeyFile(path string) Option {
+	return func(req *Request) error {
+		source, err := KeyFromFile(path)
+		if err != nil {
+			return err
+		}
+
+		req.KeySource = source
+		return nil
+	}
+}
+
+// UsePrivateKey sets the parsed private key
+func UsePrivateKey(key *ecdsa.PrivateKey) Option {
+	return func(req *Request) error {
+		source, err := KeyFromPrivateKey(key)
+		if err != nil {
+			return err
+		}
+
+		req.KeySource = source
+		return nil
+	}
+}
+
+// UseSigner sets the signer of the client secret, for keys kept in an HSM or a KMS
+func UseSigner(signer crypto.Signer) Option {
+	return func(req *Request) error {
+		if err := validateSigner(signer); err != nil {
+			return err
+		}
+
+		req.Signer = signer
+		return nil
+	}
+}
+
+// UseSecretLifetime sets the lifetime of the client secret, at most 6 months.
+// The secret is renewed after half of its lifetime.
+func UseSecretLifetime(lifetime time.Duration) Option {
+	return func(req *Request) error {
+		cache, err := NewSecretCache(lifetime, DEFAULT_SECRET_RENEW_AFTER)
+		if err != nil {
+			return err
+		}
+
+		req.SecretCache = cache
+		return nil
+	}
+}
+
+// UseClock sets the clock of the client secret, the key cache and the id token checks, for tests
+func UseClock(now func() time.Time) Option {
+	return func(req *Request) error {
+		if now == nil {
+			return ErrNilClock
+		}
+
+		req.now = now
+		return nil
+	}
+}
+
+// UseLogger sets the logger of background failures
+func UseLogger(logger Logger) Option {
+	return func(req *Request) error {
+		if logger == nil {
+			return ErrNilLogger
+		}
+
+		req.Logger = logger
+		return nil
+	}
+}
+
+// UseRetryPolicy sends requests which failed temporarily again with given policy.
+// Code validations are only sent again when they did not reach apple or were rate limited,
+// as a code can only be used once.
+func UseRetryPolicy(policy *retry.Policy) Option {
+	return func(req *Request) error {
+		if policy == nil {
+			return ErrNilRetryPolicy
+		}
+
+		req.Retry = policy
+		return nil
+	}
+}
+
+// UseHooks reports the calls to apple to given hooks, like the adapters of the observe package
+func UseHooks(hooks observe.Hooks) Option {
+	return func(req *Request) error {
+		if hooks == nil {
+			return ErrNilHooks
+		}
+
+		req.Hooks = hooks
+		return nil
+	}
+}
+
+// validate checks the identifiers and that a key is configured
+func (req *Request) validate() []error {
+	var errs []error
+
+	if !identifierRegexp.MatchString(req.TeamID) {
+		errs = append(errs, ErrInvalidTeamID)
+	}
+
+	if !clientIDRegexp.MatchString(req.ClientID) {
+		errs = append(errs, ErrInvalidClientID)
+	}
+
+	if !identifierRegexp.MatchString(req.KeyID) {
+		errs = append(errs, ErrInvalidKeyID)
+	}
+
+	if req.KeySource == nil && req.Signer == nil && len(req.ClientSecret) == 0 {
+		errs = append(errs, ErrMissingKey)
+	}
+
+	return errs
+}
+
+// setDefaults sets the defaults of fields no option set
+func (req *Request) setDefaults() {
+	if req.HttpClient == nil {
+		req.HttpClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	if req.Keys == nil {
+		req.Keys = NewKeySet(req.HttpClient)
+		req.Keys.URL = req.endpoints().Keys
+		req.Keys.Logger = req.Logger
+		req.Keys.now = req.now
+	}
+
+	if req.SecretCache == nil {
+		req.SecretCache = NewDefaultSecretCache()
+	}
+
+	if req.now != nil {
+		req.SecretCache.Now = req.now
+	}
+}
+
+// endpoints returns the configured endpoints, with apple ones for unset URLs
+func (req *Request) endpoints() Endpoints {
+	return req.Endpoints.withDefaults()
+}
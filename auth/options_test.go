@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	client := &http.Client{}
+
+	vReq, err := New(
+		UseCredentials("1234567890", "com.example.app", "ABC123DEF4"),
+		UseHTTPClient(client),
+		UsePEMKey(testSecretKey(t)),
+		UseBaseURL("http://127.0.0.1:8080"),
+		UseSecretLifetime(time.Hour*24*90),
+		UseClock(func() time.Time { return now }),
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, client, vReq.HttpClient)
+	assert.Equal(t, "http://127.0.0.1:8080/auth/keys", vReq.Keys.URL)
+	assert.Equal(t, time.Hour*24*90, vReq.SecretCache.Lifetime)
+	assert.Equal(t, now, vReq.NewRegisteredClaims().IssuedAt.Time)
+}
+
+func TestNew__defaults(t *testing.T) {
+	vReq, err := New(
+		UseCredentials("1234567890", "com.example.app", "ABC123DEF4"),
+		UsePEMKey(testSecretKey(t)),
+	)
+
+	assert.Nil(t, err)
+	assert.NotNil(t, vReq.HttpClient)
+	assert.Equal(t, KEYS_URL, vReq.Keys.URL)
+	assert.Equal(t, DEFAULT_SECRET_LIFETIME, vReq.SecretCache.Lifetime)
+}
+
+func TestNew__aggregatedErrors(t *testing.T) {
+	_, err := New(
+		UseCredentials("team", "example", "key-id-with-dashes"),
+		UseSecretLifetime(MAX_SECRET_LIFETIME*2),
+	)
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, []error{
+		ErrInvalidSecretLifetime,
+		ErrInvalidTeamID,
+		ErrInvalidClientID,
+		ErrInvalidKeyID,
+		ErrMissingKey,
+	}, configErr.Errors)
+	assert.True(t, errors.Is(err, ErrInvalidClientID))
+	assert.False(t, errors.Is(err, ErrNilLogger))
+}
+
+func TestNew__clientIDs(t *testing.T) {
+	valid := []string{"com.example.app", "com.example.app.web", "io.my-company.App2"}
+	invalid := []string{"", "example", "com..example", "com.example.", "com.example app"}
+
+	for _, clientID := range valid {
+		_, err := New(UseCredentials("1234567890", clientID, "ABC123DEF4"), UsePEMKey(testSecretKey(t)))
+		assert.Nil(t, err, clientID)
+	}
+
+	for _, clientID := range invalid {
+		_, err := New(UseCredentials("1234567890", clientID, "ABC123DEF4"), UsePEMKey(testSecretKey(t)))
+		assert.True(t, errors.Is(err, ErrInvalidClientID), clientID)
+	}
+}
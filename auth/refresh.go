@@ -0,0 +1,162 @@
+// refresh validates refresh tokens at most once per interval, as apple recommends.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Apple recommends validating refresh tokens at most once a day
+	DEFAULT_REFRESH_VALIDATION_INTERVAL = 24 * time.Hour
+)
+
+// ValidationStore remembers the last successful validation of refresh tokens.
+// Tokens are keyed by their SHA-256, the tokens themselves are never stored.
+type ValidationStore interface {
+	// LastValidated returns the time of the last validation, false when unknown
+	LastValidated(ctx context.Context, key string) (time.Time, bool, error)
+	SetValidated(ctx context.Context, key string, at time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+// RefreshTokenValidator validates refresh tokens with the client of Request,
+// skipping tokens validated less than Interval ago.
+type RefreshTokenValidator struct {
+	Request *Request
+	Store   ValidationStore
+
+	// Minimum time between validations of a token, defaults to DEFAULT_REFRESH_VALIDATION_INTERVAL
+	Interval time.Duration
+
+	now func() time.Time
+}
+
+// RefreshResult is the outcome of a refresh token validation for a user
+type RefreshResult struct {
+	// Whether apple was called, false when the token was validated within the interval.
+	Checked bool
+
+	// Whether apple reported the token as invalid, the user revoked the session.
+	Revoked bool
+
+	// Time of the last successful validation, zero when revoked.
+	ValidatedAt time.Time
+
+	// Response of apple, nil when not checked or revoked.
+	Token *TokenResponse
+}
+
+// Logout reports whether the user must be signed out
+func (r *RefreshResult) Logout() bool {
+	return r.Revoked
+}
+
+// Returns new validator for the client of req, with an in-memory store
+func NewRefreshTokenValidator(req *Request) *RefreshTokenValidator {
+	return &RefreshTokenValidator{
+		Request:  req,
+		Store:    NewMemoryValidationStore(),
+		Interval: DEFAULT_REFRESH_VALIDATION_INTERVAL,
+		now:      req.now,
+	}
+}
+
+// Validate validates refreshToken unless it was validated within the interval.
+// An invalid_grant response is reported as revoked, not as error.
+// Other failures, like network errors, are returned and do not mean the user must be signed out.
+func (v *RefreshTokenValidator) Validate(ctx context.Context, refreshToken string) (*RefreshResult, error) {
+	key := refreshTokenKey(refreshToken)
+	now := v.clock()
+
+	last, ok, err := v.Store.LastValidated(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && now.Sub(last) < v.interval() {
+		return &RefreshResult{ValidatedAt: last}, nil
+	}
+
+	resp, err := v.Request.ValidateRefreshToken(ctx, refreshToken)
+	if errors.Is(err, ErrInvalidGrant) {
+		if err := v.Store.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+		return &RefreshResult{Checked: true, Revoked: true}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.Store.SetValidated(ctx, key, now); err != nil {
+		return nil, err
+	}
+
+	return &RefreshResult{Checked: true, ValidatedAt: now, Token: resp}, nil
+}
+
+// Forget removes the last validation of refreshToken, like after signing the user out
+func (v *RefreshTokenValidator) Forget(ctx context.Context, refreshToken string) error {
+	return v.Store.Delete(ctx, refreshTokenKey(refreshToken))
+}
+
+func (v *RefreshTokenValidator) interval() time.Duration {
+	if v.Interval <= 0 {
+		return DEFAULT_REFRESH_VALIDATION_INTERVAL
+	}
+	return v.Interval
+}
+
+func (v *RefreshTokenValidator) clock() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+	return time.Now()
+}
+
+func refreshTokenKey(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryValidationStore keeps validations in memory, for a single instance.
+// It is safe for concurrent use.
+type MemoryValidationStore struct {
+	mu        sync.Mutex
+	validated map[string]time.Time
+}
+
+// Returns new empty in-memory validation store
+func NewMemoryValidationStore() *MemoryValidationStore {
+	return &MemoryValidationStore{validated: make(map[string]time.Time)}
+}
+
+func (s *MemoryValidationStore) LastValidated(ctx context.Context, key string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at, ok := s.validated[key]
+	return at, ok, nil
+}
+
+func (s *MemoryValidationStore) SetValidated(ctx context.Context, key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.validated[key] = at
+	return nil
+}
+
+func (s *MemoryValidationStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.validated, key)
+	return nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshTokenValidator(t *testing.T) {
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Nil(t, r.ParseForm())
+
+		switch r.PostForm.Get("refresh_token") {
+		case "revoked-token":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+		case "down-token":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"access_token":"access-token","expires_in":3600,"token_type":"bearer"}`))
+		}
+	})
+
+	now := time.Unix(1700000000, 0)
+	req, err := WithPEMKey(&handlerHTTPClient{handler: handler}, "1234567890", "com.example.app", "abc123def4",
+		testSecretKey(t), UseClock(func() time.Time { return now }))
+	assert.Nil(t, err)
+
+	validator := NewRefreshTokenValidator(req)
+
+	result, err := validator.Validate(context.Background(), "refresh-token")
+	assert.Nil(t, err)
+	assert.True(t, result.Checked)
+	assert.False(t, result.Logout())
+	assert.Equal(t, "access-token", result.Token.AccessToken)
+
+	// validated once per day
+	now = now.Add(23 * time.Hour)
+	result, err = validator.Validate(context.Background(), "refresh-token")
+	assert.Nil(t, err)
+	assert.False(t, result.Checked)
+	assert.Equal(t, now.Add(-23*time.Hour), result.ValidatedAt)
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Hour)
+	result, err = validator.Validate(context.Background(), "refresh-token")
+	assert.Nil(t, err)
+	assert.True(t, result.Checked)
+	assert.Equal(t, 2, calls)
+
+	result, err = validator.Validate(context.Background(), "revoked-token")
+	assert.Nil(t, err)
+	assert.True(t, result.Revoked)
+	assert.True(t, result.Logout())
+
+	// failures other than invalid_grant do not sign the user out
+	result, err = validator.Validate(context.Background(), "down-token")
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrServerError)
+}
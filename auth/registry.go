@@ -0,0 +1,176 @@
+// registry holds the clients (bundle ID, Services ID) of one team and key.
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownClient   = errors.New("no client is registered with this key")
+	ErrNoClients       = errors.New("registry needs at least one client")
+	ErrDuplicateClient = errors.New("client id is registered twice")
+)
+
+// Registry routes requests to one of several clients sharing a team and a key,
+// like the bundle ID of an app and the Services ID of a website.
+// Clients are registered by a key chosen by the caller, like "ios" or "web".
+type Registry struct {
+	clients    map[string]*Request
+	byClientID map[string]string
+}
+
+// IDTokenMatch is a verified identity token and the client it was issued for
+type IDTokenMatch struct {
+	// Key the client is registered with
+	Client string
+
+	// Client id the token audience matched
+	ClientID string
+
+	Claims *IDTokenClaims
+}
+
+// Returns new registry with a client per entry of clientIDs, keyed like clientIDs.
+// Clients copy base, with their own client id and client secret cache,
+// and share its key, http client and apple public keys.
+func NewRegistry(base *Request, clientIDs map[string]string) (*Registry, error) {
+	if len(clientIDs) == 0 {
+		return nil, ErrNoClients
+	}
+
+	registry := &Registry{
+		clients:    make(map[string]*Request, len(clientIDs)),
+		byClientID: make(map[string]string, len(clientIDs)),
+	}
+
+	var errs []error
+	for key, clientID := range clientIDs {
+		if _, ok := registry.byClientID[clientID]; ok {
+			errs = append(errs, ErrDuplicateClient)
+			continue
+		}
+
+		client := *base
+		client.ClientID = clientID
+		client.Keys = base.keySet()
+
+		if base.SecretCache != nil {
+			client.SecretCache = &SecretCache{
+				Lifetime:   base.SecretCache.Lifetime,
+				RenewAfter: base.SecretCache.RenewAfter,
+				Now:        base.SecretCache.Now,
+			}
+		}
+
+		errs = append(errs, client.validate()...)
+
+		registry.clients[key] = &client
+		registry.byClientID[clientID] = key
+	}
+
+	if len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+
+	return registry, nil
+}
+
+// Client returns the client registered with key
+func (r *Registry) Client(key string) (*Request, error) {
+	client, ok := r.clients[key]
+	if !ok {
+		return nil, ErrUnknownClient
+	}
+	return client, nil
+}
+
+// Clients returns the keys of all registered clients, sorted
+func (r *Registry) Clients() []string {
+	keys := make([]string, 0, len(r.clients))
+	for key := range r.clients {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validates the authorization code with the client registered with key
+// Returns TokenResponse and error
+func (r *Registry) ValidateCode(ctx context.Context, key, code string) (*TokenResponse, error) {
+	client, err := r.Client(key)
+	if err != nil {
+		return nil, err
+	}
+	return client.ValidateCode(ctx, code)
+}
+
+// Validates the authorization code and redirect URI with the client registered with key
+// Returns TokenResponse and error
+func (r *Registry) ValidateCodeWithRedirectURI(ctx context.Context, key, code, redirectURI string) (*TokenResponse, error) {
+	client, err := r.Client(key)
+	if err != nil {
+		return nil, err
+	}
+	return client.ValidateCodeWithRedirectURI(ctx, code, redirectURI)
+}
+
+// Validates the refresh token with the client registered with key
+// Returns TokenResponse and error
+func (r *Registry) ValidateRefreshToken(ctx context.Context, key, refreshToken string) (*TokenResponse, error) {
+	client, err := r.Client(key)
+	if err != nil {
+		return nil, err
+	}
+	return client.ValidateRefreshToken(ctx, refreshToken)
+}
+
+// VerifyIDToken verifies an identity token issued for any registered client,
+// like the token the app sends after signing in, and reports the client it matched.
+func (r *Registry) VerifyIDToken(idToken string, opts ...IDTokenOption) (*IDTokenMatch, error) {
+	return r.VerifyIDTokenContext(context.Background(), idToken, opts...)
+}
+
+// VerifyIDTokenContext is VerifyIDToken with ctx bounding the fetch of the public keys
+func (r *Registry) VerifyIDTokenContext(ctx context.Context, idToken string, opts ...IDTokenOption) (*IDTokenMatch, error) {
+	// the unverified audience only picks the client, which verifies the token
+	unverified := &IDTokenClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(idToken, unverified); err != nil {
+		return nil, err
+	}
+
+	key, ok := r.match(unverified)
+	if !ok {
+		return nil, ErrInvalidAudience
+	}
+
+	client := r.clients[key]
+	resp := &TokenResponse{
+		IDToken: idToken,
+		Claims:  &Claims{ClientID: client.ClientID, Keys: client.keySet(), now: client.now},
+	}
+
+	claims, err := resp.VerifyIDTokenContext(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IDTokenMatch{
+		Client:   key,
+		ClientID: client.ClientID,
+		Claims:   claims,
+	}, nil
+}
+
+// match returns the key of the client the audience of claims names
+func (r *Registry) match(claims *IDTokenClaims) (string, bool) {
+	for clientID, key := range r.byClientID {
+		if claims.VerifyAudience(clientID, true) {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegistry(t *testing.T, client httpClient) *Registry {
+	base, err := WithPEMKey(client, "1234567890", "com.example.app", "abc123def4", testSecretKey(t))
+	assert.Nil(t, err)
+	base.Keys = testClaims(t).Keys
+
+	registry, err := NewRegistry(base, map[string]string{
+		"ios": "com.example.app",
+		"web": "com.example.web",
+	})
+	assert.Nil(t, err)
+
+	return registry
+}
+
+func TestRegistryVerifyIDToken(t *testing.T) {
+	registry := testRegistry(t, &http.Client{})
+
+	claims := testIDTokenClaims()
+	claims["aud"] = "com.example.web"
+
+	got, err := registry.VerifyIDToken(signIDToken(t, testRSAKey, testKeyID, claims))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "web", got.Client)
+	assert.Equal(t, "com.example.web", got.ClientID)
+	assert.Equal(t, "123456", got.Claims.Subject)
+}
+
+func TestRegistryVerifyIDTokenContext(t *testing.T) {
+	registry := testRegistry(t, &http.Client{})
+	idToken := signIDToken(t, testRSAKey, testKeyID, testIDTokenClaims())
+
+	// the keys are not fetched yet, the cancelled context stops the fetch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := registry.VerifyIDTokenContext(ctx, idToken)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	got, err := registry.VerifyIDTokenContext(context.Background(), idToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "ios", got.Client)
+}
+
+func TestRegistryVerifyIDToken__unknownAudience(t *testing.T) {
+	registry := testRegistry(t, &http.Client{})
+
+	claims := testIDTokenClaims()
+	claims["aud"] = "com.other.app"
+
+	_, err := registry.VerifyIDToken(signIDToken(t, testRSAKey, testKeyID, claims))
+
+	assert.Equal(t, ErrInvalidAudience, err)
+}
+
+func TestRegistryValidateCode(t *testing.T) {
+	client := &recordingHTTPClient{statusCode: http.StatusBadRequest, body: `{"error":"invalid_grant"}`}
+	registry := testRegistry(t, client)
+
+	_, _ = registry.ValidateCode(context.Background(), "web", "auth-code")
+
+	assert.Nil(t, client.request.ParseForm())
+	assert.Equal(t, "com.example.web", client.request.PostForm.Get("client_id"))
+
+	_, err := registry.ValidateCode(context.Background(), "android", "auth-code")
+	assert.Equal(t, ErrUnknownClient, err)
+
+	assert.Equal(t, []string{"ios", "web"}, registry.Clients())
+}
+
+func TestNewRegistry__invalid(t *testing.T) {
+	base, err := WithPEMKey(&http.Client{}, "1234567890", "com.example.app", "abc123def4", testSecretKey(t))
+	assert.Nil(t, err)
+
+	_, err = NewRegistry(base, nil)
+	assert.Equal(t, ErrNoClients, err)
+
+	_, err = NewRegistry(base, map[string]string{"web": "example"})
+	assert.ErrorIs(t, err, ErrInvalidClientID)
+}
@@ -0,0 +1,83 @@
+// revoke handles the revocation of sign in tokens.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	REVOKE_URL = "https://appleid.apple.com/auth/revoke"
+)
+
+var (
+	// Token type hints for revocation
+	accessTokenTypeHint  string = "access_token"
+	refreshTokenTypeHint string = "refresh_token"
+)
+
+type Revocation interface {
+
+	// Revokes given access token
+	RevokeAccessToken(ctx context.Context, accessToken string) error
+
+	// Revokes given refresh token
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+}
+
+// Revokes given access token, to be used when the user deletes the account
+// Returns error
+func (req *Request) RevokeAccessToken(ctx context.Context, accessToken string) error {
+	return req.revoke(ctx, accessToken, accessTokenTypeHint)
+}
+
+// Revokes given refresh token, to be used when the user deletes the account
+// Returns error
+func (req *Request) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	return req.revoke(ctx, refreshToken, refreshTokenTypeHint)
+}
+
+func (req *Request) revoke(ctx context.Context, token, tokenTypeHint string) error {
+	formData, err := req.newFormData("", "", "", "")
+	if err != nil {
+		return err
+	}
+
+	formData.Add("token", token)
+	formData.Add("token_type_hint", tokenTypeHint)
+
+	return req.doRevokeRequest(ctx, formData)
+}
+
+// doRevokeRequest sends formData to the revoke endpoint, again on temporary failures with the retry policy
+func (req *Request) doRevokeRequest(ctx context.Context, formData url.Values) error {
+	return req.send(ctx, OperationRevoke, req.endpoints().Revoke, true, func(ctx context.Context) error {
+		return req.sendRevokeRequest(ctx, formData)
+	})
+}
+
+func (req *Request) sendRevokeRequest(ctx context.Context, formData url.Values) error {
+	newReq, err := http.NewRequestWithContext(ctx, "POST", req.endpoints().Revoke, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return err
+	}
+
+	newReq.Header.Add("content-type", CONTENT_TYPE)
+	newReq.Header.Add("accept", ACCEPT)
+	newReq.Header.Add("user-agent", USER_AGENT)
+
+	response, err := req.HttpClient.Do(newReq)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return readErrorResponse(response)
+	}
+
+	return nil
+}
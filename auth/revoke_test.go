@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// HTTP client which records the request and returns the given response
+type recordingHTTPClient struct {
+	request    *http.Request
+	statusCode int
+	body       string
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.request = req
+	return &http.Response{
+		StatusCode: c.statusCode,
+		Body:       io.NopCloser(strings.NewReader(c.body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+// Returns PEM encoded PKCS8 private key like the .p8 file of apple
+func testSecretKey(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	client := &recordingHTTPClient{statusCode: http.StatusOK}
+	vReq := request()
+	vReq.ClientSecret = testSecretKey(t)
+	vReq.HttpClient = client
+
+	err := vReq.RevokeRefreshToken(context.Background(), "refresh-token")
+	assert.Nil(t, err)
+
+	assert.Equal(t, REVOKE_URL, client.request.URL.String())
+	assert.Nil(t, client.request.ParseForm())
+	assert.Equal(t, "com.example.app", client.request.PostForm.Get("client_id"))
+	assert.NotEmpty(t, client.request.PostForm.Get("client_secret"))
+	assert.Equal(t, "refresh-token", client.request.PostForm.Get("token"))
+	assert.Equal(t, "refresh_token", client.request.PostForm.Get("token_type_hint"))
+	assert.Empty(t, client.request.PostForm.Get("grant_type"))
+}
+
+func TestRevokeAccessToken__error(t *testing.T) {
+	client := &recordingHTTPClient{statusCode: http.StatusBadRequest, body: `{"error":"invalid_client"}`}
+	vReq := request()
+	vReq.ClientSecret = testSecretKey(t)
+	vReq.HttpClient = client
+
+	err := vReq.RevokeAccessToken(context.Background(), "access-token")
+
+	assert.True(t, errors.Is(err, ErrInvalidClient))
+	assert.Nil(t, client.request.ParseForm())
+	assert.Equal(t, "access_token", client.request.PostForm.Get("token_type_hint"))
+}
@@ -2,17 +2,26 @@
 package auth
 
 import (
-	"crypto/x509"
-	"encoding/pem"
-	"errors"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/canopas/apple-sdk-go/retry"
 	"github.com/golang-jwt/jwt/v4"
 )
 
 const (
 	AUDIENCE = "https://appleid.apple.com"
+
+	// Lifetime of the client secret when none is configured
+	DEFAULT_SECRET_LIFETIME = time.Hour * 24 * 30 // 30 days
+
+	// Maximum lifetime of the client secret accepted by apple (6 months)
+	MAX_SECRET_LIFETIME = 15777000 * time.Second
 )
 
 type httpClient interface {
@@ -30,43 +39,122 @@ type Request struct {
 	KeyID string
 
 	// This is the private key file (.p8). You can download it from apple portal
+	// It is parsed once, on the first client secret generation.
 	ClientSecret []byte
 
+	// Provides the parsed private key, used instead of ClientSecret when set
+	KeySource KeySource
+
+	// Signs the client secret with a key kept outside of the process (HSM, KMS),
+	// used instead of KeySource and ClientSecret when set
+	Signer crypto.Signer
+
 	HttpClient httpClient
+
+	// Apple public keys used to verify identity tokens of responses.
+	// Shared default key set is used when nil.
+	Keys *KeySet
+
+	// URLs of the auth endpoints, apple endpoints are used for empty URLs
+	Endpoints Endpoints
+
+	// Reuses the signed client secret across requests.
+	// A new secret is signed for every request when nil.
+	SecretCache *SecretCache
+
+	// Reports failures of background work, nothing is logged when nil
+	Logger Logger
+
+	// Sends requests which failed temporarily again, a single attempt is made when nil
+	Retry *retry.Policy
+
+	// Reports the calls to apple for logs, metrics and traces, nothing is reported when nil
+	Hooks observe.Hooks
+
+	// clock set by UseClock, applied to the secret cache, key set and id token checks
+	now func() time.Time
+
+	// the key parsed from ClientSecret, a *parsedKey
+	clientSecretKey atomic.Value
+
+	// keys of Endpoints.Keys when Keys is nil, a *KeySet
+	endpointKeys atomic.Value
+}
+
+// parsedKey is a private key with the PEM content it was parsed from
+type parsedKey struct {
+	pem []byte
+	key *ecdsa.PrivateKey
 }
 
 // GenerateClientSecret returns a secret used to validate server requests
 // SecretRequest is required to generate secret. Method will throw error
 // if data is empty or wrong.
 func (req *Request) GenerateClientSecret() (string, error) {
+	return req.generateClientSecret(req.SecretCache.now(), req.SecretCache.lifetime())
+}
 
-	block, _ := pem.Decode(req.ClientSecret)
-	if block == nil {
-		return "", errors.New("pem block is empty after decoding")
-	}
+// generateClientSecret signs a secret issued at now and valid for lifetime
+func (req *Request) generateClientSecret(now time.Time, lifetime time.Duration) (string, error) {
 
-	prvKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	signer, err := req.signer()
 	if err != nil {
 		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, req.NewRegisteredClaims())
+	return req.signClientSecret(signer, now, lifetime)
+}
+
+// signClientSecret signs with signer a secret issued at now and valid for lifetime
+func (req *Request) signClientSecret(signer crypto.Signer, now time.Time, lifetime time.Duration) (string, error) {
+	token := jwt.NewWithClaims(signingMethodES256Signer, req.newRegisteredClaims(now, lifetime))
 	token.Header["alg"] = "ES256"
 	token.Header["kid"] = req.KeyID
 
-	return token.SignedString(prvKey)
+	return token.SignedString(signer)
+}
+
+// signer returns Signer, or the private key to sign in process when not set
+func (req *Request) signer() (crypto.Signer, error) {
+	if req.Signer != nil {
+		return req.Signer, nil
+	}
+	return req.privateKey()
+}
+
+// privateKey returns the key of KeySource, or parses ClientSecret when not set
+func (req *Request) privateKey() (*ecdsa.PrivateKey, error) {
+	if req.KeySource != nil {
+		return req.KeySource.PrivateKey()
+	}
+
+	// parsed again only when ClientSecret is replaced
+	if parsed, ok := req.clientSecretKey.Load().(*parsedKey); ok && bytes.Equal(parsed.pem, req.ClientSecret) {
+		return parsed.key, nil
+	}
+
+	key, err := ParsePrivateKey(req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	pem := append([]byte(nil), req.ClientSecret...)
+	req.clientSecretKey.Store(&parsedKey{pem: pem, key: key})
+
+	return key, nil
 }
 
 // NewRegisteredClaims generates jwt claims from SecretRequest.
+// Claims expire after the lifetime of SecretCache, 30 days by default.
 func (req *Request) NewRegisteredClaims() *jwt.RegisteredClaims {
+	return req.newRegisteredClaims(req.SecretCache.now(), req.SecretCache.lifetime())
+}
 
-	// Current time
-	now := time.Now()
-
+func (req *Request) newRegisteredClaims(now time.Time, lifetime time.Duration) *jwt.RegisteredClaims {
 	return &jwt.RegisteredClaims{
 		Issuer:    req.TeamID,
 		IssuedAt:  &jwt.NumericDate{Time: now},
-		ExpiresAt: &jwt.NumericDate{Time: now.Add(time.Hour * 24 * 30)}, // 30 days
+		ExpiresAt: &jwt.NumericDate{Time: now.Add(lifetime)},
 		Audience:  jwt.ClaimStrings{AUDIENCE},
 		Subject:   req.ClientID,
 	}
@@ -0,0 +1,149 @@
+// secretcache reuses the signed client secret until it needs renewal.
+package auth
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Fraction of the secret lifetime after which it is renewed, when none is configured
+	DEFAULT_SECRET_RENEW_AFTER = 0.5
+)
+
+var (
+	ErrInvalidSecretLifetime   = errors.New("client secret lifetime must be positive and at most 6 months")
+	ErrInvalidSecretRenewAfter = errors.New("client secret renew fraction must be greater than 0 and at most 1")
+)
+
+// SecretCache keeps the signed client secret, and signs a new one
+// once RenewAfter of its Lifetime has passed. It is safe for concurrent use.
+type SecretCache struct {
+	// Lifetime of signed secrets, at most MAX_SECRET_LIFETIME
+	Lifetime time.Duration
+
+	// Fraction of Lifetime after which the secret is renewed
+	RenewAfter float64
+
+	// Returns current time, time.Now when nil
+	Now func() time.Time
+
+	mu      sync.Mutex
+	secret  string
+	renewAt time.Time
+
+	// request the secret was signed for, a cache shared by requests
+	// of different clients signs again on every switch
+	signedBy *Request
+
+	// public key of the signing key, the secret is signed again once the key changes
+	signedWith crypto.PublicKey
+}
+
+// Returns new secret cache with given lifetime and renew fraction
+func NewSecretCache(lifetime time.Duration, renewAfter float64) (*SecretCache, error) {
+	cache := &SecretCache{
+		Lifetime:   lifetime,
+		RenewAfter: renewAfter,
+	}
+
+	if err := cache.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+// Returns new secret cache with default lifetime and renew fraction
+func NewDefaultSecretCache() *SecretCache {
+	return &SecretCache{
+		Lifetime:   DEFAULT_SECRET_LIFETIME,
+		RenewAfter: DEFAULT_SECRET_RENEW_AFTER,
+	}
+}
+
+// Validate checks the lifetime does not exceed the apple maximum of 6 months
+func (c *SecretCache) Validate() error {
+	if c.Lifetime <= 0 || c.Lifetime > MAX_SECRET_LIFETIME {
+		return ErrInvalidSecretLifetime
+	}
+
+	if c.RenewAfter <= 0 || c.RenewAfter > 1 {
+		return ErrInvalidSecretRenewAfter
+	}
+
+	return nil
+}
+
+// Invalidate drops the cached secret.
+// It is called when apple rejects the client with invalid_client,
+// a secret signed by a reloaded or replaced key is renewed without it.
+func (c *SecretCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.secret = ""
+}
+
+// get returns the cached secret of req, renewing it when due
+func (c *SecretCache) get(req *Request) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	signer, err := req.signer()
+	if err != nil {
+		return "", err
+	}
+	publicKey := signer.Public()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.secret != "" && c.signedBy == req && samePublicKey(c.signedWith, publicKey) && now.Before(c.renewAt) {
+		return c.secret, nil
+	}
+
+	secret, err := req.signClientSecret(signer, now, c.Lifetime)
+	if err != nil {
+		return "", err
+	}
+
+	c.secret = secret
+	c.signedBy = req
+	c.signedWith = publicKey
+	c.renewAt = now.Add(time.Duration(float64(c.Lifetime) * c.RenewAfter))
+
+	return secret, nil
+}
+
+// samePublicKey reports whether a and b are the same key
+func samePublicKey(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+func (c *SecretCache) now() time.Time {
+	if c != nil && c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *SecretCache) lifetime() time.Duration {
+	if c != nil && c.Lifetime > 0 {
+		return c.Lifetime
+	}
+	return DEFAULT_SECRET_LIFETIME
+}
+
+// clientSecret returns the secret of SecretCache, or signs a new one when not set
+func (req *Request) clientSecret() (string, error) {
+	if req.SecretCache == nil {
+		return req.GenerateClientSecret()
+	}
+	return req.SecretCache.get(req)
+}
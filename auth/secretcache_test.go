@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretCache(t *testing.T) {
+	signer := newCountingSigner(t)
+	vReq, err := WithSigner(&http.Client{}, "1234567890", "com.example.app", "abc123def4", signer)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	vReq.SecretCache, err = NewSecretCache(time.Hour*24*10, 0.5)
+	assert.Nil(t, err)
+	vReq.SecretCache.Now = func() time.Time { return now }
+
+	first, err := vReq.clientSecret()
+	assert.Nil(t, err)
+
+	// reused before half of the lifetime
+	now = now.Add(time.Hour * 24 * 4)
+	second, err := vReq.clientSecret()
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, signer.calls)
+
+	// renewed after half of the lifetime
+	now = now.Add(time.Hour * 24)
+	third, err := vReq.clientSecret()
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, third)
+	assert.Equal(t, 2, signer.calls)
+
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(third, claims)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(now.Add(time.Hour*24*10).Unix()), claims["exp"])
+
+	vReq.SecretCache.Invalidate()
+	_, err = vReq.clientSecret()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, signer.calls)
+}
+
+func TestSecretCache__keyChange(t *testing.T) {
+	pemKeys := [][]byte{testSecretKey(t), testSecretKey(t)}
+	loads := 0
+	source, err := NewReloadableKeySource(func() ([]byte, error) {
+		pemKey := pemKeys[loads]
+		loads++
+		return pemKey, nil
+	})
+	assert.Nil(t, err)
+
+	vReq, err := WithKeySource(&http.Client{}, "1234567890", "com.example.app", "abc123def4", source)
+	assert.Nil(t, err)
+
+	first, err := vReq.clientSecret()
+	assert.Nil(t, err)
+
+	// the secret of the rotated key is signed by the new key
+	assert.Nil(t, source.Reload())
+	second, err := vReq.clientSecret()
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+
+	key, _ := source.PrivateKey()
+	verifyClientSecret(t, second, &key.PublicKey)
+}
+
+func TestSecretCache__invalidClient(t *testing.T) {
+	client := &recordingHTTPClient{statusCode: http.StatusUnauthorized, body: `{"error":"invalid_client"}`}
+	vReq := request()
+	vReq.ClientSecret = testSecretKey(t)
+	vReq.HttpClient = client
+	vReq.SecretCache = NewDefaultSecretCache()
+
+	first, err := vReq.clientSecret()
+	assert.Nil(t, err)
+
+	err = vReq.RevokeAccessToken(context.Background(), "access-token")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	// a secret rejected by apple is not reused
+	second, err := vReq.clientSecret()
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestNewSecretCache__invalid(t *testing.T) {
+	_, err := NewSecretCache(MAX_SECRET_LIFETIME+time.Second, 0.5)
+	assert.Equal(t, ErrInvalidSecretLifetime, err)
+
+	_, err = NewSecretCache(0, 0.5)
+	assert.Equal(t, ErrInvalidSecretLifetime, err)
+
+	_, err = NewSecretCache(MAX_SECRET_LIFETIME, 1.5)
+	assert.Equal(t, ErrInvalidSecretRenewAfter, err)
+}
@@ -0,0 +1,130 @@
+// signer signs the client secret with keys kept in process or in an HSM/KMS.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Size in bytes of r and s in an ES256 signature
+const es256KeySize = 32
+
+var (
+	ErrNilSigner          = errors.New("signer is nil")
+	ErrSignerNotP256      = errors.New("signer public key is not an ECDSA P-256 key")
+	ErrInvalidSignature   = errors.New("signer returned an invalid ECDSA signature")
+	ErrSignerKeyNotSigner = errors.New("signing key is not a crypto.Signer")
+)
+
+// signingMethodSigner is the ES256 signing method for crypto.Signer keys.
+// Signers return ASN.1 DER signatures, JWTs need the raw r||s form.
+type signingMethodSigner struct{}
+
+var signingMethodES256Signer = &signingMethodSigner{}
+
+func (m *signingMethodSigner) Alg() string {
+	return jwt.SigningMethodES256.Alg()
+}
+
+func (m *signingMethodSigner) Verify(signingString, signature string, key interface{}) error {
+	return jwt.SigningMethodES256.Verify(signingString, signature, key)
+}
+
+func (m *signingMethodSigner) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", ErrSignerKeyNotSigner
+	}
+
+	digest := sha256.Sum256([]byte(signingString))
+
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := rawECDSASignature(signature)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.EncodeSegment(raw), nil
+}
+
+// rawECDSASignature converts an ASN.1 DER ECDSA signature into r||s.
+// Signatures already in r||s form, as returned by some KMS, are kept as is.
+func rawECDSASignature(signature []byte) ([]byte, error) {
+	var parsed struct {
+		R, S *big.Int
+	}
+
+	rest, err := asn1.Unmarshal(signature, &parsed)
+	if err != nil || len(rest) != 0 {
+		if len(signature) == 2*es256KeySize {
+			return signature, nil
+		}
+		return nil, ErrInvalidSignature
+	}
+
+	if parsed.R.Sign() <= 0 || parsed.S.Sign() <= 0 ||
+		parsed.R.BitLen() > 8*es256KeySize || parsed.S.BitLen() > 8*es256KeySize {
+		return nil, ErrInvalidSignature
+	}
+
+	raw := make([]byte, 2*es256KeySize)
+	parsed.R.FillBytes(raw[:es256KeySize])
+	parsed.S.FillBytes(raw[es256KeySize:])
+
+	return raw, nil
+}
+
+// LocalSigner signs with the private key of a KeySource, in process.
+type LocalSigner struct {
+	Source KeySource
+}
+
+// Returns signer using the key of given source
+func NewLocalSigner(source KeySource) *LocalSigner {
+	return &LocalSigner{Source: source}
+}
+
+// Public returns the public key, or nil if the key source fails
+func (s *LocalSigner) Public() crypto.PublicKey {
+	key, err := s.Source.PrivateKey()
+	if err != nil {
+		return nil
+	}
+	return key.Public()
+}
+
+// Sign signs the digest with the current key of the source
+func (s *LocalSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	key, err := s.Source.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Sign(rand, digest, opts)
+}
+
+// validateSigner checks that the signer holds an ECDSA P-256 key
+func validateSigner(signer crypto.Signer) error {
+	if signer == nil {
+		return ErrNilSigner
+	}
+
+	publicKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return ErrSignerNotP256
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Signer counting its signatures, see authtest.Signer for signers in DER and raw forms
+type countingSigner struct {
+	crypto.Signer
+	calls int
+}
+
+func newCountingSigner(t *testing.T) *countingSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	return &countingSigner{Signer: key}
+}
+
+func (s *countingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+// Parses the client secret and verifies its signature with given public key
+func verifyClientSecret(t *testing.T, secret string, publicKey *ecdsa.PublicKey) *jwt.Token {
+	token, err := jwt.Parse(secret, func(token *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	})
+	assert.Nil(t, err)
+	return token
+}
+
+func TestGenerateClientSecret__localSigner(t *testing.T) {
+	source, err := KeyFromPEM(testSecretKey(t))
+	assert.Nil(t, err)
+
+	vReq, err := WithSigner(&http.Client{}, "1234567890", "com.example.app", "abc123def4", NewLocalSigner(source))
+	assert.Nil(t, err)
+
+	secret, err := vReq.GenerateClientSecret()
+	assert.Nil(t, err)
+
+	key, _ := source.PrivateKey()
+	verifyClientSecret(t, secret, &key.PublicKey)
+}
+
+func TestWithSigner__invalidKey(t *testing.T) {
+	_, err := WithSigner(&http.Client{}, "1234567890", "com.example.app", "abc123def4", testRSAKey)
+	assert.Equal(t, ErrSignerNotP256, err)
+
+	_, err = WithSigner(&http.Client{}, "1234567890", "com.example.app", "abc123def4", nil)
+	assert.Equal(t, ErrNilSigner, err)
+}
+
+func TestRawECDSASignature__invalid(t *testing.T) {
+	_, err := rawECDSASignature([]byte("not a signature"))
+	assert.Equal(t, ErrInvalidSignature, err)
+}
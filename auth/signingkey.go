@@ -0,0 +1,185 @@
+// signingkey loads the private key (.p8) used to sign the client secret.
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrEmptyPEMBlock    = errors.New("pem block is empty after decoding")
+	ErrKeyNotECDSA      = errors.New("private key is not an ECDSA key, apple keys (.p8) are ECDSA P-256 keys")
+	ErrKeyNotP256       = errors.New("private key is not on the P-256 curve, apple keys (.p8) are ECDSA P-256 keys")
+	ErrNilPrivateKey    = errors.New("private key is nil")
+	ErrEmptyKeyEnv      = errors.New("private key environment variable is empty or not set")
+	ErrNilKeySource     = errors.New("key source is nil")
+	ErrNilKeySourceLoad = errors.New("key source load function is nil")
+)
+
+// KeySource provides the private key used to sign the client secret.
+// Implementations can return a different key after rotation,
+// the key is asked for on every client secret generation.
+type KeySource interface {
+	PrivateKey() (*ecdsa.PrivateKey, error)
+}
+
+// staticKeySource always returns the same parsed key
+type staticKeySource struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *staticKeySource) PrivateKey() (*ecdsa.PrivateKey, error) {
+	return s.key, nil
+}
+
+// Returns key source of an already parsed private key
+func KeyFromPrivateKey(key *ecdsa.PrivateKey) (KeySource, error) {
+	if err := validatePrivateKey(key); err != nil {
+		return nil, err
+	}
+	return &staticKeySource{key: key}, nil
+}
+
+// Returns key source of the PEM encoded private key (.p8 file content)
+func KeyFromPEM(pemKey []byte) (KeySource, error) {
+	key, err := ParsePrivateKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	return &staticKeySource{key: key}, nil
+}
+
+// Returns key source of the private key file (.p8)
+func KeyFromFile(path string) (KeySource, error) {
+	if path == "" {
+		return nil, errors.New(InvalidSecretFileMsg)
+	}
+
+	pemKey, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return KeyFromPEM(pemKey)
+}
+
+// Returns key source of the private key in the given environment variable.
+// The variable holds the PEM encoded key, or the key base64 encoded as a whole
+// for environments which do not support multiline values.
+func KeyFromEnv(name string) (KeySource, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil, ErrEmptyKeyEnv
+	}
+
+	if !strings.HasPrefix(value, "-----BEGIN") {
+		if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+			value = string(decoded)
+		}
+	}
+
+	return KeyFromPEM([]byte(value))
+}
+
+// ReloadableKeySource loads the PEM encoded private key with the load function,
+// for keys stored in secret managers, and loads it again on Reload.
+// It is safe for concurrent use.
+type ReloadableKeySource struct {
+	load func() ([]byte, error)
+
+	mu  sync.RWMutex
+	key *ecdsa.PrivateKey
+}
+
+// Returns reloadable key source which loads the key with given function.
+// The key is loaded once before returning.
+func NewReloadableKeySource(load func() ([]byte, error)) (*ReloadableKeySource, error) {
+	if load == nil {
+		return nil, ErrNilKeySourceLoad
+	}
+
+	source := &ReloadableKeySource{load: load}
+	if err := source.Reload(); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// PrivateKey returns the last loaded key
+func (s *ReloadableKeySource) PrivateKey() (*ecdsa.PrivateKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.key, nil
+}
+
+// Reload loads and parses the key again.
+// The previous key is kept if the new one can not be loaded.
+func (s *ReloadableKeySource) Reload() error {
+	pemKey, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	key, err := ParsePrivateKey(pemKey)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.key = key
+	s.mu.Unlock()
+
+	return nil
+}
+
+// ParsePrivateKey parses the PEM encoded PKCS8 (.p8) or SEC1 private key
+// and checks that it is an ECDSA P-256 key
+func ParsePrivateKey(pemKey []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, ErrEmptyPEMBlock
+	}
+
+	var parsed interface{}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		ecKey, ecErr := x509.ParseECPrivateKey(block.Bytes)
+		if ecErr != nil {
+			return nil, err
+		}
+		parsed = ecKey
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrKeyNotECDSA
+	}
+
+	if err := validatePrivateKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func validatePrivateKey(key *ecdsa.PrivateKey) error {
+	if key == nil {
+		return ErrNilPrivateKey
+	}
+
+	if key.Curve != elliptic.P256() {
+		return ErrKeyNotP256
+	}
+
+	return nil
+}
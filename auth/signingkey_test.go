@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pemEncodePKCS8(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := ParsePrivateKey(testSecretKey(t))
+
+	assert.Nil(t, err)
+	assert.Equal(t, elliptic.P256(), key.Curve)
+}
+
+func TestParsePrivateKey__invalidKeys(t *testing.T) {
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	_, err := ParsePrivateKey(pemEncodePKCS8(t, testRSAKey))
+	assert.Equal(t, ErrKeyNotECDSA, err)
+
+	_, err = ParsePrivateKey(pemEncodePKCS8(t, p384Key))
+	assert.Equal(t, ErrKeyNotP256, err)
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.Equal(t, ErrEmptyPEMBlock, err)
+
+	_, err = KeyFromPrivateKey(p384Key)
+	assert.Equal(t, ErrKeyNotP256, err)
+}
+
+func TestKeyFromEnv(t *testing.T) {
+	pemKey := testSecretKey(t)
+
+	t.Setenv("APPLE_KEY_PEM", string(pemKey))
+	_, err := KeyFromEnv("APPLE_KEY_PEM")
+	assert.Nil(t, err)
+
+	t.Setenv("APPLE_KEY_BASE64", base64.StdEncoding.EncodeToString(pemKey))
+	_, err = KeyFromEnv("APPLE_KEY_BASE64")
+	assert.Nil(t, err)
+
+	_, err = KeyFromEnv("APPLE_KEY_MISSING")
+	assert.Equal(t, ErrEmptyKeyEnv, err)
+}
+
+func TestReloadableKeySource(t *testing.T) {
+	pemKeys := [][]byte{testSecretKey(t), testSecretKey(t), []byte("broken")}
+	loads := 0
+
+	source, err := NewReloadableKeySource(func() ([]byte, error) {
+		pemKey := pemKeys[loads]
+		loads++
+		return pemKey, nil
+	})
+	assert.Nil(t, err)
+
+	first, _ := source.PrivateKey()
+	assert.Nil(t, source.Reload())
+
+	second, _ := source.PrivateKey()
+	assert.False(t, first.Equal(second))
+
+	// previous key is kept when reload fails
+	assert.Equal(t, ErrEmptyPEMBlock, source.Reload())
+	current, _ := source.PrivateKey()
+	assert.True(t, second.Equal(current))
+}
+
+func TestWithKeySource(t *testing.T) {
+	_, err := WithKeySource(&http.Client{}, "1234567890", "com.example.app", "abc123def4", nil)
+	assert.Equal(t, ErrNilKeySource, err)
+
+	vReq, err := WithPEMKey(&http.Client{}, "1234567890", "com.example.app", "abc123def4", testSecretKey(t))
+	assert.Nil(t, err)
+
+	secret, err := vReq.GenerateClientSecret()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, secret)
+}
+
+func TestCreateRequest__keyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AuthKey.p8")
+	assert.Nil(t, os.WriteFile(path, pemEncodePKCS8(t, testRSAKey), 0600))
+
+	_, err := createRequest("1234567890", "com.example.app", "abc123def4", path, &http.Client{})
+
+	assert.True(t, errors.Is(err, ErrKeyNotECDSA))
+}
+
+func TestPrivateKey__clientSecretParsedOnce(t *testing.T) {
+	vReq := &Request{ClientSecret: testSecretKey(t)}
+
+	first, err := vReq.privateKey()
+	assert.Nil(t, err)
+
+	second, err := vReq.privateKey()
+	assert.Nil(t, err)
+	assert.Same(t, first, second)
+
+	// a replaced key is parsed again
+	vReq.ClientSecret = testSecretKey(t)
+	third, err := vReq.privateKey()
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.D, third.D)
+}
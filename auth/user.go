@@ -2,16 +2,46 @@
 package auth
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v4"
 )
 
+var (
+	ErrInvalidSigningMethod = errors.New("id token is not signed with RS256")
+	ErrMissingKeyID         = errors.New("id token header has no kid")
+	ErrInvalidIssuer        = errors.New("id token issuer is not apple")
+	ErrInvalidAudience      = errors.New("id token audience does not match client id")
+	ErrTokenExpired         = errors.New("id token is expired or has no exp claim")
+	ErrInvalidIssuedAt      = errors.New("id token is issued in the future or has no iat claim")
+)
+
+// Allowed clock difference with apple for the exp and iat claims
+const idTokenLeeway = time.Minute
+
 type claims interface {
-	GetClaims(idToken string) (jwt.MapClaims, error)
+	GetClaims(idToken string) (*IDTokenClaims, error)
+}
+
+// contextClaims are claims which look up the keys with the context of the caller
+type contextClaims interface {
+	GetClaimsContext(ctx context.Context, idToken string) (*IDTokenClaims, error)
 }
 
-type Claims struct{}
+// Claims verifies identity tokens issued by Apple.
+type Claims struct {
+	// ClientID the token audience must match
+	ClientID string
+
+	// Keys used to verify the token signature.
+	// Shared default key set is used when nil.
+	Keys *KeySet
+
+	// clock of the request, time.Now when nil
+	now func() time.Time
+}
 
 // User will have the information of authenticated user of Apple.
 type User struct {
@@ -37,66 +67,153 @@ type User struct {
 	RealUserStatus int `json:"real_user_status"`
 }
 
-// GetClaims decodes the idToken and returns the claims
-func (c *Claims) GetClaims(idToken string) (jwt.MapClaims, error) {
-	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return "", nil
-	})
-	if err != nil {
+// GetClaims verifies the idToken signature against Apple's public keys,
+// checks iss, aud, exp and iat, and returns the claims
+func (c *Claims) GetClaims(idToken string) (*IDTokenClaims, error) {
+	return c.GetClaimsContext(context.Background(), idToken)
+}
+
+// GetClaimsContext is GetClaims with ctx bounding the fetch of the public keys,
+// when the key of the token is not cached yet
+func (c *Claims) GetClaimsContext(ctx context.Context, idToken string) (*IDTokenClaims, error) {
+	keys := c.Keys
+	if keys == nil {
+		keys = getDefaultKeySet()
+	}
+
+	claims := &IDTokenClaims{}
+	if err := parseAppleToken(ctx, idToken, claims, keys); err != nil {
+		return nil, err
+	}
+
+	if err := c.verify(claims); err != nil {
 		return nil, err
 	}
 
 	return claims, nil
 }
 
+// parseAppleToken verifies the RS256 signature of token against keys and decodes its claims.
+// Registered claims are not checked, callers verify them to report typed errors.
+func parseAppleToken(ctx context.Context, token string, claims jwt.Claims, keys *KeySet) error {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+
+	_, err := parser.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, ErrInvalidSigningMethod
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrMissingKeyID
+		}
+
+		return keys.PublicKey(ctx, kid)
+	})
+	if err != nil {
+		var vErr *jwt.ValidationError
+		if errors.As(err, &vErr) && vErr.Inner != nil {
+			return vErr.Inner
+		}
+		return err
+	}
+
+	return nil
+}
+
+// verify checks the registered claims of a signature verified token
+func (c *Claims) verify(claims *IDTokenClaims) error {
+	now := c.clock()
+
+	if !claims.VerifyIssuer(AUDIENCE, true) {
+		return ErrInvalidIssuer
+	}
+
+	if c.ClientID == "" || !claims.VerifyAudience(c.ClientID, true) {
+		return ErrInvalidAudience
+	}
+
+	if claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Add(idTokenLeeway)) {
+		return ErrTokenExpired
+	}
+
+	if claims.IssuedAt == nil || claims.IssuedAt.After(now.Add(idTokenLeeway)) {
+		return ErrInvalidIssuedAt
+	}
+
+	return nil
+}
+
+func (c *Claims) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
 // UniqueID returns the unique subject ID to identify the user
 func (resp *TokenResponse) UniqueID() (string, error) {
-	claims, err := resp.Claims.GetClaims(resp.IDToken)
-	return fmt.Sprintf("%v", claims["sub"]), err
+	return resp.UniqueIDContext(context.Background())
+}
+
+// UniqueIDContext is UniqueID with ctx bounding the fetch of the public keys
+func (resp *TokenResponse) UniqueIDContext(ctx context.Context) (string, error) {
+	claims, err := resp.getClaims(ctx)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
 }
 
 // Email returns the user email
 func (resp *TokenResponse) Email() (string, error) {
-	claims, err := resp.Claims.GetClaims(resp.IDToken)
-	return fmt.Sprintf("%v", claims["email"]), err
+	return resp.EmailContext(context.Background())
+}
+
+// EmailContext is Email with ctx bounding the fetch of the public keys
+func (resp *TokenResponse) EmailContext(ctx context.Context) (string, error) {
+	claims, err := resp.getClaims(ctx)
+	if err != nil {
+		return "", err
+	}
+	return claims.Email, nil
 }
 
 // RealUserStatus returns whether the user appears to be a real person.
 // The possible values are: 0 (or Unsupported), 1 (or Unknown), 2 (or LikelyReal).
 func (resp *TokenResponse) RealUserStatus() (int, error) {
-	claims, err := resp.Claims.GetClaims(resp.IDToken)
-	return claims["real_user_status"].(int), err
+	return resp.RealUserStatusContext(context.Background())
 }
 
-// GetUser will get claims, and returns the user using claims
-func (resp *TokenResponse) GetUser() (*User, error) {
-	claims, err := resp.Claims.GetClaims(resp.IDToken)
+// RealUserStatusContext is RealUserStatus with ctx bounding the fetch of the public keys
+func (resp *TokenResponse) RealUserStatusContext(ctx context.Context) (int, error) {
+	claims, err := resp.getClaims(ctx)
 	if err != nil {
-		return nil, err
-	}
-
-	var user User
-
-	if sub, ok := claims["sub"].(string); ok {
-		user.ID = sub
+		return 0, err
 	}
+	return int(claims.RealUserStatus), nil
+}
 
-	if email, ok := claims["email"].(string); ok {
-		user.Email = email
-	}
+// GetUser will get claims, and returns the user using claims
+// Given options add checks of the nonce and hash claims, see VerifyIDToken
+func (resp *TokenResponse) GetUser(opts ...IDTokenOption) (*User, error) {
+	return resp.GetUserContext(context.Background(), opts...)
+}
 
-	if realUserStatus, ok := claims["real_user_status"].(int); ok {
-		user.RealUserStatus = realUserStatus
+// GetUserContext is GetUser with ctx bounding the fetch of the public keys
+func (resp *TokenResponse) GetUserContext(ctx context.Context, opts ...IDTokenOption) (*User, error) {
+	claims, err := resp.VerifyIDTokenContext(ctx, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	if emailVerified, ok := claims["email_verified"].(bool); ok {
-		user.EmailVerified = emailVerified
-	}
+	return claims.User(), nil
+}
 
-	if isPrivateEmail, ok := claims["is_private_email"].(bool); ok {
-		user.IsPrivateEmail = isPrivateEmail
+// getClaims returns the claims of the identity token, looked up with ctx when the claims support it
+func (resp *TokenResponse) getClaims(ctx context.Context) (*IDTokenClaims, error) {
+	if c, ok := resp.Claims.(contextClaims); ok {
+		return c.GetClaimsContext(ctx, resp.IDToken)
 	}
-
-	return &user, nil
+	return resp.Claims.GetClaims(resp.IDToken)
 }
@@ -1,9 +1,10 @@
 package auth
 
 import (
+	"encoding/json"
 	"testing"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -13,14 +14,14 @@ type MockedClaims struct {
 }
 
 // Mocked function PostForm that does not call any server, just return the expected response.
-func (m *MockedClaims) GetClaims(idToken string) (claims jwt.MapClaims, err error) {
+func (m *MockedClaims) GetClaims(idToken string) (claims *IDTokenClaims, err error) {
 	user := getUser()
-	claims = jwt.MapClaims{
-		"sub":              user.ID,
-		"email":            user.Email,
-		"email_verified":   user.EmailVerified,
-		"is_private_email": user.IsPrivateEmail,
-		"real_user_status": user.RealUserStatus,
+	claims = &IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: user.ID},
+		Email:            user.Email,
+		EmailVerified:    StringBool(user.EmailVerified),
+		IsPrivateEmail:   StringBool(user.IsPrivateEmail),
+		RealUserStatus:   StringInt(user.RealUserStatus),
 	}
 	return claims, nil
 }
@@ -74,3 +75,62 @@ func getUser() *User {
 		RealUserStatus: 2,
 	}
 }
+
+func TestIDTokenClaims__stringValues(t *testing.T) {
+	var claims IDTokenClaims
+	err := json.Unmarshal([]byte(`{
+		"sub": "123456",
+		"email": "john.doe@gmail.com",
+		"email_verified": "true",
+		"is_private_email": "false",
+		"real_user_status": "2",
+		"nonce_supported": true,
+		"auth_time": 1667260800,
+		"transfer_sub": "transfer.123456",
+		"org_id": "org-1"
+	}`), &claims)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &User{
+		ID:             "123456",
+		Email:          "john.doe@gmail.com",
+		EmailVerified:  true,
+		IsPrivateEmail: false,
+		RealUserStatus: RealUserStatusLikelyReal,
+	}, claims.User())
+	assert.Equal(t, StringBool(true), *claims.NonceSupported)
+	assert.Equal(t, int64(1667260800), claims.AuthTime.Unix())
+	assert.Equal(t, "transfer.123456", claims.TransferSub)
+	assert.Equal(t, "org-1", claims.OrgID)
+}
+
+func TestIDTokenClaims__nativeValues(t *testing.T) {
+	var claims IDTokenClaims
+	err := json.Unmarshal([]byte(`{"email_verified": true, "is_private_email": true, "real_user_status": 1}`), &claims)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StringBool(true), claims.EmailVerified)
+	assert.Equal(t, StringBool(true), claims.IsPrivateEmail)
+	assert.Equal(t, StringInt(RealUserStatusUnknown), claims.RealUserStatus)
+	assert.Nil(t, claims.NonceSupported)
+}
+
+func TestIDTokenClaims__invalidValues(t *testing.T) {
+	var claims IDTokenClaims
+
+	err := json.Unmarshal([]byte(`{"email_verified": "yes"}`), &claims)
+	assert.Equal(t, ErrInvalidStringBool, err)
+
+	err = json.Unmarshal([]byte(`{"real_user_status": "likely"}`), &claims)
+	assert.Equal(t, ErrInvalidStringInt, err)
+}
+
+func TestRealUserStatus__signedToken(t *testing.T) {
+	claims := testIDTokenClaims()
+	claims["real_user_status"] = 2
+
+	got, err := testTokenResponse(t, claims).RealUserStatus()
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RealUserStatusLikelyReal, got)
+}
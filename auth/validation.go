@@ -4,7 +4,6 @@ package auth
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"net/url"
 	"strings"
@@ -51,6 +50,10 @@ var (
 	// The requested scope is invalid.
 	InvalidScope    string = "invalid_scope"
 	InvalidScopeMsg string = "The requested scope is invalid."
+
+	// The authorization server doesn't support the revocation of the presented token type.
+	UnsupportedTokenType    string = "unsupported_token_type"
+	UnsupportedTokenTypeMsg string = "The authorization server does not support the revocation of the presented token type."
 )
 
 type Validation interface {
@@ -95,6 +98,9 @@ type TokenResponse struct {
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+
+	// Human readable details of the error, not always sent by apple
+	ErrorDescription string `json:"error_description,omitempty"`
 }
 
 // Validates request using the authorization code received in an authorization
@@ -128,8 +134,32 @@ func (req *Request) ValidateRefreshToken(ctx context.Context, refreshToken strin
 	return req.doRequest(ctx, formData)
 }
 
+// doRequest sends formData to the token endpoint, again on temporary failures with the retry policy
 func (req *Request) doRequest(ctx context.Context, formData url.Values) (*TokenResponse, error) {
-	newReq, err := http.NewRequestWithContext(ctx, "POST", VALIDATION_URL, strings.NewReader(formData.Encode()))
+	grantType := formData.Get("grant_type")
+
+	// a code can only be used once, apple may have consumed it before failing
+	idempotent := grantType != authGrantType
+
+	var tokenResponse *TokenResponse
+	err := req.send(ctx, tokenOperation(grantType), req.endpoints().Token, idempotent, func(ctx context.Context) error {
+		resp, err := req.sendTokenRequest(ctx, formData)
+		if err != nil {
+			return err
+		}
+
+		tokenResponse = resp
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenResponse, nil
+}
+
+func (req *Request) sendTokenRequest(ctx context.Context, formData url.Values) (*TokenResponse, error) {
+	newReq, err := http.NewRequestWithContext(ctx, "POST", req.endpoints().Token, strings.NewReader(formData.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -143,12 +173,10 @@ func (req *Request) doRequest(ctx context.Context, formData url.Values) (*TokenR
 		return nil, err
 	}
 
+	defer response.Body.Close()
+
 	if response.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.NewDecoder(response.Body).Decode(&errResp); err != nil {
-			return nil, err
-		}
-		return nil, errorResponse(errResp)
+		return nil, readErrorResponse(response)
 	}
 
 	var tokenResponse TokenResponse
@@ -156,7 +184,11 @@ func (req *Request) doRequest(ctx context.Context, formData url.Values) (*TokenR
 		return nil, err
 	}
 
-	tokenResponse.Claims = &Claims{}
+	tokenResponse.Claims = &Claims{
+		ClientID: req.ClientID,
+		Keys:     req.keySet(),
+		now:      req.now,
+	}
 
 	return &tokenResponse, nil
 }
@@ -166,7 +198,7 @@ func (req *Request) newFormData(code, grantType, redirectURI, refreshToken strin
 
 	formData := make(url.Values)
 
-	secret, err := req.GenerateClientSecret()
+	secret, err := req.clientSecret()
 
 	if err != nil {
 		return nil, err
@@ -174,7 +206,10 @@ func (req *Request) newFormData(code, grantType, redirectURI, refreshToken strin
 
 	formData.Add("client_id", req.ClientID)
 	formData.Add("client_secret", secret)
-	formData.Add("grant_type", grantType)
+
+	if grantType != "" {
+		formData.Add("grant_type", grantType)
+	}
 
 	if code != "" {
 		formData.Add("code", code)
@@ -191,29 +226,41 @@ func (req *Request) newFormData(code, grantType, redirectURI, refreshToken strin
 	return formData, nil
 }
 
-func errorResponse(err ErrorResponse) error {
+// errorResponse converts the OAuth error of apple into an APIError
+func errorResponse(err ErrorResponse) *APIError {
+	return &APIError{
+		Code:        err.Error,
+		Description: err.ErrorDescription,
+	}
+}
 
-	switch err.Error {
+// errorMessage returns the message of the OAuth error code
+func errorMessage(code string) string {
+
+	switch code {
 	case InvalidRequest:
-		return errors.New(InvalidRequestMsg)
+		return InvalidRequestMsg
 
 	case InvalidClient:
-		return errors.New(InvalidClientMsg)
+		return InvalidClientMsg
 
 	case InvalidGrant:
-		return errors.New(InvalidGrantMsg)
+		return InvalidGrantMsg
 
 	case UnauthorizedClient:
-		return errors.New(UnauthorizedClientMsg)
+		return UnauthorizedClientMsg
 
 	case UnsupportedGrantType:
-		return errors.New(UnsupportedGrantTypeMsg)
+		return UnsupportedGrantTypeMsg
 
 	case InvalidScope:
-		return errors.New(InvalidScopeMsg)
+		return InvalidScopeMsg
+
+	case UnsupportedTokenType:
+		return UnsupportedTokenTypeMsg
 
 	default:
-		return errors.New("Unrecognized error: " + err.Error)
+		return "Unrecognized error: " + code
 	}
 
 }
@@ -23,12 +23,14 @@ func (m *MockedHTTPClient) Do(req *http.Request) (resp *http.Response, err error
 }
 
 func TestErrorResponse(t *testing.T) {
-	expected := errors.New("The requested scope is invalid.")
+	expected := "The requested scope is invalid."
 	got := errorResponse(ErrorResponse{
 		Error: "invalid_scope",
 	})
 
-	assert.Equal(t, expected, got)
+	assert.Equal(t, expected, got.Error())
+	assert.True(t, errors.Is(got, ErrInvalidScope))
+	assert.False(t, errors.Is(got, ErrInvalidGrant))
 }
 
 func TestGenerateClientSecret__emptyBlock(t *testing.T) {
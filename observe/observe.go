@@ -0,0 +1,97 @@
+// Package observe reports the calls of the auth and receipt clients to apple,
+// for logs, metrics and traces. Hooks never see request or response bodies,
+// and error messages are redacted with Redact.
+package observe
+
+import (
+	"context"
+	"time"
+)
+
+// Services of the calls
+const (
+	ServiceAuth    = "auth"
+	ServiceReceipt = "receipt"
+)
+
+// Call is a call to an apple endpoint, including its retries
+type Call struct {
+	// The client making the call, ServiceAuth or ServiceReceipt.
+	Service string
+
+	// What the call does, like validate_code or verify_sandbox.
+	Operation string
+
+	// The URL of the endpoint, without query.
+	Endpoint string
+}
+
+// Result is the outcome of a call
+type Result struct {
+	// The HTTP status of the last attempt, 0 when no response was received.
+	StatusCode int
+
+	// The error code of apple in the last response, like invalid_grant
+	// or the receipt status 21007. Empty when apple reported no error.
+	AppleCode string
+
+	// Number of attempts made, 0 when the call was failed fast by the circuit breaker.
+	Attempts int
+
+	Duration time.Duration
+
+	Err error
+}
+
+// Retries returns the number of attempts after the first one
+func (r *Result) Retries() int {
+	if r.Attempts <= 1 {
+		return 0
+	}
+	return r.Attempts - 1
+}
+
+// Hooks are told about each call to apple.
+// Start returns the context of the call, like with a tracing span,
+// and End gets that context once the call is done.
+type Hooks interface {
+	Start(ctx context.Context, call *Call) context.Context
+	End(ctx context.Context, call *Call, result *Result)
+}
+
+// Start reports the start of call to hooks and returns the context of the call
+// and the function reporting its end. Nil hooks report nothing.
+func Start(ctx context.Context, hooks Hooks, call *Call) (context.Context, func(result *Result)) {
+	if hooks == nil {
+		return ctx, func(*Result) {}
+	}
+
+	started := time.Now()
+	ctx = hooks.Start(ctx, call)
+
+	return ctx, func(result *Result) {
+		result.Duration = time.Since(started)
+		hooks.End(ctx, call, result)
+	}
+}
+
+// multiHooks reports calls to several hooks, in order
+type multiHooks []Hooks
+
+// Multi returns hooks reporting calls to all given hooks
+func Multi(hooks ...Hooks) Hooks {
+	return multiHooks(hooks)
+}
+
+func (m multiHooks) Start(ctx context.Context, call *Call) context.Context {
+	for _, h := range m {
+		ctx = h.Start(ctx, call)
+	}
+	return ctx
+}
+
+func (m multiHooks) End(ctx context.Context, call *Call, result *Result) {
+	for _, h := range m {
+		h.End(ctx, call, result)
+	}
+}
@@ -0,0 +1,61 @@
+// Package otelobserve traces the calls to apple with OpenTelemetry.
+package otelobserve
+
+import (
+	"context"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the instrumentation scope of the spans
+const TRACER_NAME = "github.com/canopas/apple-sdk-go/observe/otelobserve"
+
+// Hooks starts a client span for each call to apple, named like "apple.auth validate_code".
+// Failed calls record their redacted error and set the span status to error.
+type Hooks struct {
+	Tracer trace.Tracer
+}
+
+// Returns hooks tracing with provider, or with the global provider when nil
+func New(provider trace.TracerProvider) *Hooks {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Hooks{Tracer: provider.Tracer(TRACER_NAME)}
+}
+
+func (h *Hooks) Start(ctx context.Context, call *observe.Call) context.Context {
+	ctx, _ = h.Tracer.Start(ctx, "apple."+call.Service+" "+call.Operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("apple.service", call.Service),
+			attribute.String("apple.operation", call.Operation),
+			attribute.String("url.full", call.Endpoint),
+		))
+	return ctx
+}
+
+func (h *Hooks) End(ctx context.Context, call *observe.Call, result *observe.Result) {
+	span := trace.SpanFromContext(ctx)
+
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", result.StatusCode),
+		attribute.Int("apple.attempts", result.Attempts),
+	)
+
+	if result.AppleCode != "" {
+		span.SetAttributes(attribute.String("apple.code", result.AppleCode))
+	}
+
+	if result.Err != nil {
+		message := observe.ErrorMessage(result.Err)
+		span.AddEvent("exception", trace.WithAttributes(attribute.String("exception.message", message)))
+		span.SetStatus(codes.Error, message)
+	}
+
+	span.End()
+}
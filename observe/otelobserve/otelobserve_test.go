@@ -0,0 +1,41 @@
+package otelobserve
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHooks(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	hooks := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, end := observe.Start(context.Background(), hooks, &observe.Call{
+		Service:   observe.ServiceAuth,
+		Operation: "validate_refresh_token",
+		Endpoint:  "https://appleid.apple.com/auth/token",
+	})
+	end(&observe.Result{
+		StatusCode: 400,
+		AppleCode:  "invalid_grant",
+		Attempts:   1,
+		Err:        errors.New("refresh_token=r1b2c3 is invalid"),
+	})
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "apple.auth validate_refresh_token", span.Name())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, "refresh_token=[REDACTED] is invalid", span.Status().Description)
+	assert.Contains(t, span.Attributes(), attribute.String("apple.code", "invalid_grant"))
+	assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", 400))
+}
@@ -0,0 +1,66 @@
+// Package promobserve exports Prometheus metrics of the calls to apple.
+package promobserve
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Hooks counts the calls to apple and observes their duration, labelled by
+// service, operation, HTTP status and apple code, and counts their retries.
+type Hooks struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	retries  *prometheus.CounterVec
+}
+
+// Returns hooks with metrics registered with registerer under namespace, like "apple".
+// Metrics are apple_requests_total, apple_request_duration_seconds and apple_request_retries_total.
+func New(registerer prometheus.Registerer, namespace string) (*Hooks, error) {
+	h := &Hooks{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Calls to apple endpoints, including their retries.",
+		}, []string{"service", "operation", "status", "apple_code"}),
+
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the calls to apple endpoints, including their retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "operation", "status"}),
+
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_retries_total",
+			Help:      "Attempts after the first one of the calls to apple endpoints.",
+		}, []string{"service", "operation"}),
+	}
+
+	for _, collector := range []prometheus.Collector{h.requests, h.duration, h.retries} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func (h *Hooks) Start(ctx context.Context, call *observe.Call) context.Context {
+	return ctx
+}
+
+func (h *Hooks) End(ctx context.Context, call *observe.Call, result *observe.Result) {
+	status := strconv.Itoa(result.StatusCode)
+
+	h.requests.WithLabelValues(call.Service, call.Operation, status, result.AppleCode).Inc()
+	h.duration.WithLabelValues(call.Service, call.Operation, status).Observe(result.Duration.Seconds())
+
+	if retries := result.Retries(); retries > 0 {
+		h.retries.WithLabelValues(call.Service, call.Operation).Add(float64(retries))
+	}
+}
@@ -0,0 +1,34 @@
+package promobserve
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	hooks, err := New(registry, "apple")
+	assert.Nil(t, err)
+
+	call := &observe.Call{Service: observe.ServiceReceipt, Operation: "verify_sandbox"}
+	_, end := observe.Start(context.Background(), hooks, call)
+	end(&observe.Result{StatusCode: 200, Attempts: 3})
+
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP apple_requests_total Calls to apple endpoints, including their retries.
+# TYPE apple_requests_total counter
+apple_requests_total{apple_code="",operation="verify_sandbox",service="receipt",status="200"} 1
+# HELP apple_request_retries_total Attempts after the first one of the calls to apple endpoints.
+# TYPE apple_request_retries_total counter
+apple_request_retries_total{operation="verify_sandbox",service="receipt"} 2
+`), "apple_requests_total", "apple_request_retries_total"))
+
+	_, err = New(registry, "apple")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,42 @@
+// redact removes secrets, tokens and receipts from messages reported by hooks.
+package observe
+
+import (
+	"regexp"
+)
+
+// Replacement of redacted values
+const REDACTED = "[REDACTED]"
+
+// Names of the fields holding secrets in requests to apple
+const secretFields = `client_secret|refresh_token|access_token|id_token|code|token|transfer_sub|receipt-data|password`
+
+var (
+	// form and JSON values of the secrets sent to apple
+	secretFieldRegexp = regexp.MustCompile(`(?i)("(?:` + secretFields + `)"\s*:\s*"?|\b(?:` + secretFields + `)=)[^&"\s,}]+`)
+
+	// JWTs, like client secrets and id tokens
+	jwtRegexp = regexp.MustCompile(`[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)
+
+	// long base64 values, like receipts and refresh tokens
+	base64Regexp = regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`)
+
+	// bearer authorization headers
+	bearerRegexp = regexp.MustCompile(`(?i)(bearer\s+)\S+`)
+)
+
+// Redact replaces secrets, tokens and receipts in message with REDACTED
+func Redact(message string) string {
+	message = secretFieldRegexp.ReplaceAllString(message, "${1}"+REDACTED)
+	message = bearerRegexp.ReplaceAllString(message, "${1}"+REDACTED)
+	message = jwtRegexp.ReplaceAllString(message, REDACTED)
+	return base64Regexp.ReplaceAllString(message, REDACTED)
+}
+
+// ErrorMessage returns the redacted message of err, empty for nil
+func ErrorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Redact(err.Error())
+}
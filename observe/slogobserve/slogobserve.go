@@ -0,0 +1,50 @@
+// Package slogobserve logs the calls to apple with log/slog.
+package slogobserve
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/canopas/apple-sdk-go/observe"
+)
+
+// Hooks logs each call to apple once done, at info level when it succeeded
+// and at warn level when it failed. Error messages are redacted.
+type Hooks struct {
+	Logger *slog.Logger
+}
+
+// Returns hooks logging with logger, or with slog.Default when nil
+func New(logger *slog.Logger) *Hooks {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Hooks{Logger: logger}
+}
+
+func (h *Hooks) Start(ctx context.Context, call *observe.Call) context.Context {
+	return ctx
+}
+
+func (h *Hooks) End(ctx context.Context, call *observe.Call, result *observe.Result) {
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.String("service", call.Service),
+		slog.String("operation", call.Operation),
+		slog.String("endpoint", call.Endpoint),
+		slog.Int("status", result.StatusCode),
+		slog.Int("attempts", result.Attempts),
+		slog.Duration("duration", result.Duration),
+	}
+
+	if result.AppleCode != "" {
+		attrs = append(attrs, slog.String("apple_code", result.AppleCode))
+	}
+
+	if result.Err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", observe.ErrorMessage(result.Err)))
+	}
+
+	h.Logger.LogAttrs(ctx, level, "apple call", attrs...)
+}
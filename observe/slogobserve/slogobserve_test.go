@@ -0,0 +1,39 @@
+package slogobserve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	var buf bytes.Buffer
+	hooks := New(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	_, end := observe.Start(context.Background(), hooks, &observe.Call{
+		Service:   observe.ServiceAuth,
+		Operation: "validate_code",
+		Endpoint:  "https://appleid.apple.com/auth/token",
+	})
+
+	end(&observe.Result{
+		StatusCode: 400,
+		AppleCode:  "invalid_grant",
+		Attempts:   1,
+		Err:        errors.New("invalid code=c1a2b3d4"),
+	})
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "validate_code", entry["operation"])
+	assert.Equal(t, "invalid_grant", entry["apple_code"])
+	assert.Equal(t, "invalid code=[REDACTED]", entry["error"])
+}
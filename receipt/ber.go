@@ -0,0 +1,175 @@
+// ber normalises the BER encoding of the receipt containers to DER, as encoding/asn1 only reads DER.
+package receipt
+
+import "bytes"
+
+const (
+	// Maximum nesting of the elements of a container
+	maxBERDepth = 32
+
+	berConstructed       = 0x20
+	berOctetString       = 0x04
+	berIndefiniteLength  = 0x80
+	berMaxLengthBytes    = 4
+	berHighTagNumberMask = 0x1f
+)
+
+// berElement is a decoded element, with its value encoded in DER
+type berElement struct {
+	identifier []byte
+	value      []byte
+}
+
+// berToDER re-encodes ber in DER: indefinite lengths are replaced with definite ones, lengths are
+// encoded in the minimum number of bytes and constructed octet strings are joined in one primitive string.
+// DER input is returned unchanged.
+func berToDER(ber []byte) ([]byte, error) {
+	element, rest, err := readBER(ber, 0)
+	if err != nil || len(rest) > 0 {
+		return nil, ErrInvalidPKCS7
+	}
+	return element.der(), nil
+}
+
+// readBER reads the first element of ber and returns it with the bytes following it
+func readBER(ber []byte, depth int) (*berElement, []byte, error) {
+	if depth > maxBERDepth || len(ber) == 0 {
+		return nil, nil, ErrInvalidPKCS7
+	}
+
+	offset := 1
+	if ber[0]&berHighTagNumberMask == berHighTagNumberMask {
+		for {
+			if offset >= len(ber) {
+				return nil, nil, ErrInvalidPKCS7
+			}
+			offset++
+			if ber[offset-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if offset >= len(ber) {
+		return nil, nil, ErrInvalidPKCS7
+	}
+
+	element := &berElement{identifier: ber[:offset]}
+	constructed := ber[0]&berConstructed != 0
+
+	lengthByte := ber[offset]
+	offset++
+
+	if lengthByte == berIndefiniteLength {
+		if !constructed {
+			return nil, nil, ErrInvalidPKCS7
+		}
+
+		// children follow until the end-of-contents octets
+		var children []*berElement
+		rest := ber[offset:]
+		for {
+			if len(rest) < 2 {
+				return nil, nil, ErrInvalidPKCS7
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+
+			child, next, err := readBER(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			children = append(children, child)
+			rest = next
+		}
+
+		if err := element.join(children); err != nil {
+			return nil, nil, err
+		}
+		return element, rest, nil
+	}
+
+	length := int(lengthByte)
+	if lengthByte&0x80 != 0 {
+		n := int(lengthByte &^ 0x80)
+		if n == 0 || n > berMaxLengthBytes || offset+n > len(ber) {
+			return nil, nil, ErrInvalidPKCS7
+		}
+
+		length = 0
+		for _, b := range ber[offset : offset+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+
+	if length < 0 || length > len(ber)-offset {
+		return nil, nil, ErrInvalidPKCS7
+	}
+
+	content, rest := ber[offset:offset+length], ber[offset+length:]
+	if !constructed {
+		element.value = content
+		return element, rest, nil
+	}
+
+	var children []*berElement
+	for len(content) > 0 {
+		child, next, err := readBER(content, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, child)
+		content = next
+	}
+
+	if err := element.join(children); err != nil {
+		return nil, nil, err
+	}
+	return element, rest, nil
+}
+
+// join sets the value of a constructed element from its children.
+// The segments of a constructed octet string are joined in a primitive octet string, as DER requires.
+func (e *berElement) join(children []*berElement) error {
+	var value bytes.Buffer
+
+	if len(e.identifier) == 1 && e.identifier[0] == berOctetString|berConstructed {
+		for _, child := range children {
+			if len(child.identifier) != 1 || child.identifier[0] != berOctetString {
+				return ErrInvalidPKCS7
+			}
+			value.Write(child.value)
+		}
+		e.identifier = []byte{berOctetString}
+		e.value = value.Bytes()
+		return nil
+	}
+
+	for _, child := range children {
+		value.Write(child.der())
+	}
+	e.value = value.Bytes()
+	return nil
+}
+
+// der returns the DER encoding of the element, with the length in the minimum number of bytes
+func (e *berElement) der() []byte {
+	der := append([]byte{}, e.identifier...)
+
+	length := len(e.value)
+	if length < 0x80 {
+		der = append(der, byte(length))
+	} else {
+		var lengthBytes []byte
+		for ; length > 0; length >>= 8 {
+			lengthBytes = append([]byte{byte(length)}, lengthBytes...)
+		}
+		der = append(der, 0x80|byte(len(lengthBytes)))
+		der = append(der, lengthBytes...)
+	}
+
+	return append(der, e.value...)
+}
@@ -0,0 +1,79 @@
+package receipt
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+// Returns the DER container of the sandbox receipt fixture
+func sandboxReceipt(t *testing.T) []byte {
+	data, err := os.ReadFile("testdata/sandbox_receipt.pem")
+	assert.NoError(t, err)
+
+	block, _ := pem.Decode(data)
+	assert.NotNil(t, block)
+	return block.Bytes
+}
+
+// Re-encodes the constructed elements of der with indefinite lengths, like the App Store receipts
+func indefiniteLength(t *testing.T, der []byte) []byte {
+	var element asn1.RawValue
+	_, err := asn1.Unmarshal(der, &element)
+	assert.NoError(t, err)
+
+	if !element.IsCompound {
+		return element.FullBytes
+	}
+
+	ber := []byte{element.FullBytes[0], 0x80}
+	for children := element.Bytes; len(children) > 0; {
+		var child asn1.RawValue
+		children, err = asn1.Unmarshal(children, &child)
+		assert.NoError(t, err)
+		ber = append(ber, indefiniteLength(t, child.FullBytes)...)
+	}
+	return append(ber, 0, 0)
+}
+
+func TestBERToDER(t *testing.T) {
+	der := sandboxReceipt(t)
+
+	got, err := berToDER(der)
+	assert.NoError(t, err)
+	assert.Equal(t, der, got)
+
+	ber := indefiniteLength(t, der)
+	assert.NotEqual(t, der, ber)
+
+	got, err = berToDER(ber)
+	assert.NoError(t, err)
+	assert.Equal(t, der, got)
+
+	signed, err := parsePKCS7(ber)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mac App Store and iTunes Store Receipt Signing", signed.signer.Subject.CommonName)
+}
+
+func TestBERToDER__constructedOctetString(t *testing.T) {
+	// segmented octet string of indefinite length, with a long form length
+	ber := []byte{0x24, 0x80, 0x04, 0x81, 0x02, 'a', 'b', 0x04, 0x01, 'c', 0x00, 0x00}
+
+	got, err := berToDER(ber)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x03, 'a', 'b', 'c'}, got)
+
+	for name, ber := range map[string][]byte{
+		"missing end of contents": {0x30, 0x80, 0x02, 0x01, 0x01},
+		"indefinite primitive":    {0x04, 0x80, 0x00, 0x00},
+		"truncated":               {0x30, 0x05, 0x02, 0x01},
+		"trailing bytes":          {0x02, 0x01, 0x01, 0x00},
+		"segment not a string":    {0x24, 0x03, 0x02, 0x01, 0x01},
+	} {
+		_, err := berToDER(ber)
+		assert.Equal(t, ErrInvalidPKCS7, err, name)
+	}
+}
@@ -0,0 +1,98 @@
+// dates gives the receipt dates as time.Time.
+package receipt
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/applejson"
+)
+
+var (
+	ErrInvalidEpochMillis = errors.New("date is neither a number nor a string of milliseconds since epoch")
+)
+
+// EpochMillis is a time in milliseconds since the UNIX epoch,
+// which the App Store sends either as a string or as a number.
+// Zero when the date is not present.
+type EpochMillis int64
+
+func (m *EpochMillis) UnmarshalJSON(b []byte) error {
+	number, ok := applejson.NumberText(b)
+	if !ok {
+		return ErrInvalidEpochMillis
+	}
+
+	if number == "" {
+		*m = 0
+		return nil
+	}
+
+	parsed, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return ErrInvalidEpochMillis
+	}
+
+	*m = EpochMillis(parsed)
+	return nil
+}
+
+// MarshalJSON encodes the time as a string, as the App Store sends it
+func (m EpochMillis) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(m), 10))
+}
+
+// Time returns the time in UTC, or the zero time when not present
+func (m EpochMillis) Time() time.Time {
+	if m == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(m)).UTC()
+}
+
+// IsZero reports whether the date is not present
+func (m EpochMillis) IsZero() bool {
+	return m == 0
+}
+
+// CreationTime returns the time the App Store generated the receipt
+func (d ReceiptCreationDate) CreationTime() time.Time {
+	return d.CreationDateMS.Time()
+}
+
+// RequestTime returns the time the verification request was processed
+func (d RequestDate) RequestTime() time.Time {
+	return d.RequestDateMS.Time()
+}
+
+// PurchaseTime returns the time the App Store charged the user
+func (d PurchaseDate) PurchaseTime() time.Time {
+	return d.PurchaseDateMS.Time()
+}
+
+// OriginalPurchaseTime returns the time of the original purchase
+func (d OriginalPurchaseDate) OriginalPurchaseTime() time.Time {
+	return d.OriginalPurchaseDateMS.Time()
+}
+
+// PreorderTime returns the time the user pre-ordered the app, zero when not pre-ordered
+func (d PreorderDate) PreorderTime() time.Time {
+	return d.PreorderDateMS.Time()
+}
+
+// ExpiresTime returns the time the subscription or receipt expires, zero when it does not
+func (d ExpiresDate) ExpiresTime() time.Time {
+	return d.ExpiresDateMS.Time()
+}
+
+// CancellationTime returns the time the transaction was refunded or revoked, zero when it was not
+func (d CancellationDate) CancellationTime() time.Time {
+	return d.CancellationDateMS.Time()
+}
+
+// GracePeriodTime returns the time the billing grace period expires, zero when not in grace period
+func (d GracePeriodDate) GracePeriodTime() time.Time {
+	return d.GracePeriodDateMS.Time()
+}
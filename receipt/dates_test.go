@@ -0,0 +1,70 @@
+package receipt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func TestEpochMillis(t *testing.T) {
+	purchased := time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	for name, data := range map[string]string{
+		"string": `{"purchase_date_ms":"1646130600000"}`,
+		"number": `{"purchase_date_ms":1646130600000}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var date PurchaseDate
+			assert.NoError(t, json.Unmarshal([]byte(data), &date))
+			assert.Equal(t, purchased, date.PurchaseTime())
+		})
+	}
+
+	var date ExpiresDate
+	assert.NoError(t, json.Unmarshal([]byte(`{"expires_date_ms":""}`), &date))
+	assert.True(t, date.ExpiresDateMS.IsZero())
+	assert.True(t, date.ExpiresTime().IsZero())
+
+	assert.Equal(t, ErrInvalidEpochMillis, json.Unmarshal([]byte(`{"expires_date_ms":"soon"}`), &date))
+}
+
+func TestInApp__typedFields(t *testing.T) {
+	data := `{"quantity":"2","product_id":"monthly","transaction_id":"1000","original_transaction_id":"1000",` +
+		`"promotional_offer_id":"","is_trial_period":"true","is_in_intro_offer_period":false,` +
+		`"cancellation_reason":"1","purchase_date":"","purchase_date_ms":"1646130600000","purchase_date_pst":"",` +
+		`"original_purchase_date":"","original_purchase_date_ms":1646130600000,"original_purchase_date_pst":"",` +
+		`"expires_date_ms":"1648809000000","cancellation_date_ms":"1647000000000"}`
+
+	var inApp InApp
+	assert.NoError(t, json.Unmarshal([]byte(data), &inApp))
+
+	assert.Equal(t, StringInt(2), inApp.Quantity)
+	assert.True(t, bool(inApp.IsTrialPeriod))
+	assert.False(t, bool(inApp.IsInIntroOfferPeriod))
+	assert.Equal(t, CancellationReasonAppIssue, inApp.CancellationReason)
+	assert.Equal(t, inApp.PurchaseTime(), inApp.OriginalPurchaseTime())
+	assert.Equal(t, time.Date(2022, 4, 1, 10, 30, 0, 0, time.UTC), inApp.ExpiresTime())
+	assert.False(t, inApp.CancellationTime().IsZero())
+	assert.True(t, PendingRenewalInfo{}.GracePeriodTime().IsZero())
+
+	// values are encoded back as the strings apple sends
+	encoded, err := json.Marshal(inApp)
+	assert.NoError(t, err)
+
+	var raw map[string]interface{}
+	assert.NoError(t, json.Unmarshal(encoded, &raw))
+	assert.Equal(t, "2", raw["quantity"])
+	assert.Equal(t, "true", raw["is_trial_period"])
+	assert.Equal(t, "false", raw["is_in_intro_offer_period"])
+	assert.Equal(t, "1", raw["cancellation_reason"])
+	assert.Equal(t, "1646130600000", raw["original_purchase_date_ms"])
+
+	var decoded InApp
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, inApp, decoded)
+
+	assert.Equal(t, ErrInvalidStringBool, json.Unmarshal([]byte(`{"is_trial_period":"maybe"}`), &decoded))
+	assert.Equal(t, ErrInvalidStringInt, json.Unmarshal([]byte(`{"quantity":"many"}`), &decoded))
+}
@@ -0,0 +1,190 @@
+// entitlements computes the state of auto-renewable subscriptions from a verified receipt.
+package receipt
+
+import (
+	"sort"
+	"time"
+)
+
+// States of an auto-renewable subscription
+const (
+	// The subscription period has not ended
+	StateActive SubscriptionState = "active"
+
+	// Renewal failed with a billing error, the user keeps access until the grace period ends
+	StateGracePeriod SubscriptionState = "grace_period"
+
+	// Renewal failed with a billing error, the App Store is still trying to renew
+	StateBillingRetry SubscriptionState = "billing_retry"
+
+	// The subscription period ended, see ExpirationIntent for the reason
+	StateExpired SubscriptionState = "expired"
+
+	// The App Store refunded the transaction or revoked it from family sharing
+	StateRevoked SubscriptionState = "revoked"
+
+	// The user upgraded to another subscription of the group
+	StateUpgraded SubscriptionState = "upgraded"
+)
+
+// Reasons a subscription expired
+// https://developer.apple.com/documentation/appstorereceipts/expiration_intent
+const (
+	ExpirationIntentCancelled          = "1"
+	ExpirationIntentBillingError       = "2"
+	ExpirationIntentPriceIncrease      = "3"
+	ExpirationIntentProductUnavailable = "4"
+	ExpirationIntentUnknown            = "5"
+)
+
+// SubscriptionState is the state of an auto-renewable subscription at a given time
+type SubscriptionState string
+
+// Entitlement is the state of a subscription, identified by its subscription group
+// and the transaction identifier of its original purchase
+type Entitlement struct {
+	SubscriptionGroup     string
+	OriginalTransactionID string
+
+	// Product of the latest transaction
+	ProductID string
+
+	State SubscriptionState
+
+	// Time access ends: the end of the grace period while in grace period,
+	// the cancellation time when revoked, the end of the subscription period otherwise
+	ExpiresAt time.Time
+
+	// Reason the subscription expired, one of the ExpirationIntent values, empty when unknown
+	ExpirationIntent string
+
+	// Product the subscription renews to and whether it renews
+	AutoRenewProductID string
+	AutoRenew          bool
+
+	// Whether the latest transaction is in the free trial or introductory offer period
+	IsTrialPeriod        bool
+	IsInIntroOfferPeriod bool
+
+	// Latest transaction of the subscription
+	Transaction InApp
+
+	// Renewal information of the subscription, nil when the App Store sent none
+	Renewal *PendingRenewalInfo
+}
+
+// HasAccess reports whether the user is entitled to the subscription content
+func (e *Entitlement) HasAccess() bool {
+	return e.State == StateActive || e.State == StateGracePeriod
+}
+
+// Entitlements returns the state at now of each auto-renewable subscription of a verified response,
+// ordered by subscription group and original transaction identifier.
+// Transactions come from LatestReceiptInfo, or from the receipt when the App Store sent none.
+// Transactions without expiration date, which are not auto-renewable subscriptions, are ignored.
+func Entitlements(resp *IAPResponse, now time.Time) []Entitlement {
+	if resp == nil {
+		return nil
+	}
+
+	transactions := resp.LatestReceiptInfo
+	if len(transactions) == 0 {
+		transactions = resp.Receipt.InApp
+	}
+
+	type key struct {
+		group                 string
+		originalTransactionID string
+	}
+
+	latest := make(map[key]InApp)
+	for _, transaction := range transactions {
+		if transaction.ExpiresDateMS.IsZero() {
+			continue
+		}
+
+		k := key{transaction.SubscriptionGroupIdentifier, transaction.OriginalTransactionID}
+		if current, ok := latest[k]; !ok || newerTransaction(transaction, current) {
+			latest[k] = transaction
+		}
+	}
+
+	renewals := make(map[string]*PendingRenewalInfo, len(resp.PendingRenewalInfo))
+	for i := range resp.PendingRenewalInfo {
+		renewals[resp.PendingRenewalInfo[i].OriginalTransactionID] = &resp.PendingRenewalInfo[i]
+	}
+
+	entitlements := make([]Entitlement, 0, len(latest))
+	for k, transaction := range latest {
+		entitlements = append(entitlements, newEntitlement(k.group, transaction, renewals[k.originalTransactionID], now))
+	}
+
+	sort.Slice(entitlements, func(i, j int) bool {
+		if entitlements[i].SubscriptionGroup != entitlements[j].SubscriptionGroup {
+			return entitlements[i].SubscriptionGroup < entitlements[j].SubscriptionGroup
+		}
+		return entitlements[i].OriginalTransactionID < entitlements[j].OriginalTransactionID
+	})
+
+	return entitlements
+}
+
+// newerTransaction reports whether a was purchased after b.
+// Of transactions purchased at the same time, the one which was not upgraded is newer.
+func newerTransaction(a, b InApp) bool {
+	if a.PurchaseDateMS != b.PurchaseDateMS {
+		return a.PurchaseDateMS > b.PurchaseDateMS
+	}
+
+	if a.IsUpgraded != b.IsUpgraded {
+		return !bool(a.IsUpgraded)
+	}
+
+	return a.ExpiresDateMS > b.ExpiresDateMS
+}
+
+func newEntitlement(group string, transaction InApp, renewal *PendingRenewalInfo, now time.Time) Entitlement {
+	entitlement := Entitlement{
+		SubscriptionGroup:     group,
+		OriginalTransactionID: transaction.OriginalTransactionID,
+		ProductID:             transaction.ProductID,
+		ExpiresAt:             transaction.ExpiresTime(),
+		IsTrialPeriod:         bool(transaction.IsTrialPeriod),
+		IsInIntroOfferPeriod:  bool(transaction.IsInIntroOfferPeriod),
+		Transaction:           transaction,
+		Renewal:               renewal,
+	}
+
+	if renewal != nil {
+		entitlement.AutoRenewProductID = renewal.SubscriptionAutoRenewProductID
+		entitlement.AutoRenew = renewal.SubscriptionAutoRenewStatus == "1"
+	}
+
+	switch {
+	case bool(transaction.IsUpgraded):
+		entitlement.State = StateUpgraded
+
+	case !transaction.CancellationDateMS.IsZero():
+		entitlement.State = StateRevoked
+		entitlement.ExpiresAt = transaction.CancellationTime()
+
+	case now.Before(entitlement.ExpiresAt):
+		entitlement.State = StateActive
+
+	case renewal != nil && now.Before(renewal.GracePeriodTime()):
+		entitlement.State = StateGracePeriod
+		entitlement.ExpiresAt = renewal.GracePeriodTime()
+
+	case renewal != nil && renewal.SubscriptionRetryFlag == "1":
+		entitlement.State = StateBillingRetry
+		entitlement.ExpirationIntent = renewal.SubscriptionExpirationIntent
+
+	default:
+		entitlement.State = StateExpired
+		if renewal != nil {
+			entitlement.ExpirationIntent = renewal.SubscriptionExpirationIntent
+		}
+	}
+
+	return entitlement
+}
@@ -0,0 +1,172 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func subscription(otid, product string, purchased, expires time.Time) InApp {
+	transaction := InApp{
+		ProductID:                   product,
+		TransactionID:               otid + "-" + product,
+		OriginalTransactionID:       otid,
+		SubscriptionGroupIdentifier: "premium",
+	}
+	transaction.PurchaseDateMS = EpochMillis(purchased.UnixMilli())
+	transaction.ExpiresDateMS = EpochMillis(expires.UnixMilli())
+	return transaction
+}
+
+func TestEntitlements(t *testing.T) {
+	now := time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC)
+	month := 30 * 24 * time.Hour
+
+	renewal := func(otid string) PendingRenewalInfo {
+		return PendingRenewalInfo{
+			OriginalTransactionID:          otid,
+			SubscriptionAutoRenewProductID: "yearly",
+			SubscriptionAutoRenewStatus:    "1",
+		}
+	}
+
+	tests := []struct {
+		name         string
+		transactions []InApp
+		renewal      func(*PendingRenewalInfo)
+		state        SubscriptionState
+		expiresAt    time.Time
+		intent       string
+	}{
+		{
+			name: "active renewal",
+			transactions: []InApp{
+				subscription("1", "monthly", now.Add(-2*month), now.Add(-month)),
+				subscription("1", "monthly", now.Add(-month), now.Add(month)),
+			},
+			state:     StateActive,
+			expiresAt: now.Add(month),
+		},
+		{
+			name:         "grace period",
+			transactions: []InApp{subscription("1", "monthly", now.Add(-month), now.Add(-time.Hour))},
+			renewal: func(r *PendingRenewalInfo) {
+				r.SubscriptionRetryFlag = "1"
+				r.GracePeriodDateMS = EpochMillis(now.Add(time.Hour).UnixMilli())
+			},
+			state:     StateGracePeriod,
+			expiresAt: now.Add(time.Hour),
+		},
+		{
+			name:         "billing retry",
+			transactions: []InApp{subscription("1", "monthly", now.Add(-month), now.Add(-time.Hour))},
+			renewal: func(r *PendingRenewalInfo) {
+				r.SubscriptionRetryFlag = "1"
+				r.SubscriptionExpirationIntent = ExpirationIntentBillingError
+			},
+			state:     StateBillingRetry,
+			expiresAt: now.Add(-time.Hour),
+			intent:    ExpirationIntentBillingError,
+		},
+		{
+			name:         "expired",
+			transactions: []InApp{subscription("1", "monthly", now.Add(-month), now.Add(-time.Hour))},
+			renewal: func(r *PendingRenewalInfo) {
+				r.SubscriptionAutoRenewStatus = "0"
+				r.SubscriptionExpirationIntent = ExpirationIntentCancelled
+			},
+			state:     StateExpired,
+			expiresAt: now.Add(-time.Hour),
+			intent:    ExpirationIntentCancelled,
+		},
+		{
+			name: "refunded",
+			transactions: func() []InApp {
+				transaction := subscription("1", "monthly", now.Add(-month), now.Add(month))
+				transaction.CancellationDateMS = EpochMillis(now.Add(-time.Hour).UnixMilli())
+				transaction.CancellationReason = CancellationReasonAppIssue
+				return []InApp{transaction}
+			}(),
+			state:     StateRevoked,
+			expiresAt: now.Add(-time.Hour),
+		},
+		{
+			name: "upgraded",
+			transactions: func() []InApp {
+				transaction := subscription("1", "monthly", now.Add(-month), now.Add(month))
+				transaction.IsUpgraded = true
+				return []InApp{transaction}
+			}(),
+			state:     StateUpgraded,
+			expiresAt: now.Add(month),
+		},
+		{
+			name: "upgrade replaces the upgraded transaction",
+			transactions: func() []InApp {
+				upgraded := subscription("1", "monthly", now.Add(-time.Hour), now.Add(month))
+				upgraded.IsUpgraded = true
+				return []InApp{upgraded, subscription("1", "yearly", now.Add(-time.Hour), now.Add(12*month))}
+			}(),
+			state:     StateActive,
+			expiresAt: now.Add(12 * month),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := renewal("1")
+			if test.renewal != nil {
+				test.renewal(&r)
+			}
+
+			entitlements := Entitlements(&IAPResponse{
+				LatestReceiptInfo:  test.transactions,
+				PendingRenewalInfo: []PendingRenewalInfo{r},
+			}, now)
+
+			assert.Len(t, entitlements, 1)
+			assert.Equal(t, "premium", entitlements[0].SubscriptionGroup)
+			assert.Equal(t, "1", entitlements[0].OriginalTransactionID)
+			assert.Equal(t, test.state, entitlements[0].State)
+			assert.Equal(t, test.expiresAt.UnixMilli(), entitlements[0].ExpiresAt.UnixMilli())
+			assert.Equal(t, test.intent, entitlements[0].ExpirationIntent)
+			assert.Equal(t, test.state == StateActive || test.state == StateGracePeriod, entitlements[0].HasAccess())
+		})
+	}
+}
+
+func TestEntitlements__groups(t *testing.T) {
+	now := time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	trial := subscription("2", "pro", now.Add(-time.Hour), now.Add(7*24*time.Hour))
+	trial.SubscriptionGroupIdentifier = "pro"
+	trial.IsTrialPeriod = true
+
+	consumable := InApp{ProductID: "coins", OriginalTransactionID: "3"}
+
+	entitlements := Entitlements(&IAPResponse{
+		Receipt: Receipt{InApp: []InApp{
+			trial,
+			subscription("1", "monthly", now.Add(-time.Hour), now.Add(time.Hour)),
+			consumable,
+		}},
+		PendingRenewalInfo: []PendingRenewalInfo{
+			{OriginalTransactionID: "2", SubscriptionAutoRenewProductID: "pro", SubscriptionAutoRenewStatus: "1"},
+		},
+	}, now)
+
+	assert.Len(t, entitlements, 2)
+
+	assert.Equal(t, "premium", entitlements[0].SubscriptionGroup)
+	assert.Nil(t, entitlements[0].Renewal)
+	assert.False(t, entitlements[0].AutoRenew)
+
+	assert.Equal(t, "pro", entitlements[1].SubscriptionGroup)
+	assert.Equal(t, StateActive, entitlements[1].State)
+	assert.True(t, entitlements[1].IsTrialPeriod)
+	assert.True(t, entitlements[1].AutoRenew)
+	assert.Equal(t, "pro", entitlements[1].AutoRenewProductID)
+
+	assert.Nil(t, Entitlements(nil, now))
+}
@@ -0,0 +1,75 @@
+// environment routes verifications to the production and sandbox endpoints.
+package receipt
+
+import "errors"
+
+// Policies routing verifications to the App Store environments
+const (
+	// Production first, then sandbox when production answers 21007. Default.
+	ProductionWithSandboxFallback EnvironmentPolicy = iota
+
+	// Production only, sandbox receipts are answered with 21007.
+	// Use it in production builds, so that sandbox receipts are never accepted as real purchases.
+	ProductionOnly
+
+	// Sandbox only, production receipts are answered with 21008
+	SandboxOnly
+
+	// Sandbox first, then production when sandbox answers 21008, for TestFlight and development builds
+	SandboxFirst
+)
+
+var (
+	ErrInvalidEnvironment = errors.New("unknown environment policy")
+)
+
+// EnvironmentPolicy decides which endpoints verify a receipt, and in which order
+type EnvironmentPolicy int
+
+// route describes the endpoints of a policy
+type route struct {
+	url string
+
+	// Endpoint tried when url answers fallbackStatus, none when empty
+	fallbackURL       string
+	fallbackStatus    int
+	fallbackOperation string
+}
+
+func (p EnvironmentPolicy) route() (route, error) {
+	switch p {
+	case ProductionWithSandboxFallback:
+		return route{
+			url:               PRODUCTION_URL,
+			fallbackURL:       SANDBOX_URL,
+			fallbackStatus:    21007,
+			fallbackOperation: OperationVerifySandbox,
+		}, nil
+	case ProductionOnly:
+		return route{url: PRODUCTION_URL}, nil
+	case SandboxOnly:
+		return route{url: SANDBOX_URL}, nil
+	case SandboxFirst:
+		return route{
+			url:               SANDBOX_URL,
+			fallbackURL:       PRODUCTION_URL,
+			fallbackStatus:    21008,
+			fallbackOperation: OperationVerifyProduction,
+		}, nil
+	}
+	return route{}, ErrInvalidEnvironment
+}
+
+func (p EnvironmentPolicy) String() string {
+	switch p {
+	case ProductionWithSandboxFallback:
+		return "production_with_sandbox_fallback"
+	case ProductionOnly:
+		return "production_only"
+	case SandboxOnly:
+		return "sandbox_only"
+	case SandboxFirst:
+		return "sandbox_first"
+	}
+	return "unknown"
+}
@@ -18,6 +18,9 @@ var (
 	ErrDuplicateReceipt        = errors.New("duplicate receipt")
 	ErrInternalDataAccessError = errors.New("internal data access error")
 	ErrUnknown                 = errors.New("an unknown error occurred")
+
+	// the response status is temporary, the verification is sent again
+	errRetryableStatus = errors.New("the App Store responded with a temporary status")
 )
 
 // Returns error message by status code
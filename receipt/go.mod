@@ -3,6 +3,9 @@ module github.com/canopas/apple-sdk-go/receipt
 go 1.18
 
 require (
+	github.com/canopas/apple-sdk-go/applejson v0.1.0
+	github.com/canopas/apple-sdk-go/observe v0.1.0
+	github.com/canopas/apple-sdk-go/retry v0.1.0
 	github.com/stretchr/testify v1.8.1
 	github.com/tj/assert v0.0.3
 )
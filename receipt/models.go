@@ -3,19 +3,61 @@ package receipt
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/canopas/apple-sdk-go/applejson"
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/canopas/apple-sdk-go/retry"
 )
 
 type httpClient interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
 
+// Reasons of a refunded or revoked transaction
+const (
+	// The customer canceled due to an actual or perceived issue within the app
+	CancellationReasonAppIssue CancellationReason = "1"
+
+	// The transaction was canceled for another reason, like an accidental purchase
+	CancellationReasonOther CancellationReason = "0"
+)
+
+var (
+	ErrInvalidStringBool = applejson.ErrInvalidBool
+	ErrInvalidStringInt  = applejson.ErrInvalidInt
+
+	ErrInvalidCancellationReason = errors.New("cancellation reason is not a number")
+)
+
 type (
 	numericString string
 
+	// StringInt is an integer the App Store sends either as a number or as a string
+	StringInt = applejson.StringInt
+
+	// StringBool is a boolean the App Store sends either as a boolean or as a string
+	StringBool = applejson.StringBool
+
+	// CancellationReason is the reason of a refunded or revoked transaction
+	CancellationReason string
+
 	// Receipt client with http client
 	Client struct {
 		HttpClient httpClient
+
+		// Sends verifications which failed temporarily again, a single attempt is made when nil
+		Retry *retry.Policy
+
+		// Reports the calls to the App Store for logs, metrics and traces, nothing is reported when nil
+		Hooks observe.Hooks
+
+		// Endpoints verifying the receipts, defaults to ProductionWithSandboxFallback
+		Environment EnvironmentPolicy
+
+		// Checks valid receipts belong to the app, required: Verify fails without bundle identifiers
+		Validation *Validation
 	}
 
 	// The JSON contents you submit with the request to the App Store.
@@ -61,6 +103,10 @@ type (
 		PendingRenewalInfo []PendingRenewalInfo `json:"pending_renewal_info,omitempty"`
 
 		IsRetryable bool `json:"is-retryable,omitempty"`
+
+		// The endpoint which served the response, PRODUCTION_URL or SANDBOX_URL.
+		// It is not sent by the App Store.
+		Endpoint string `json:"-"`
 	}
 
 	// An array that contains the in-app purchase receipt fields for all in-app purchase transactions.
@@ -69,7 +115,7 @@ type (
 		// The number of consumable products purchased.
 		// This value corresponds to the quantity property of the SKPayment object stored in the transaction's payment property.
 		// The value is usually "1" unless modified with a mutable payment. The maximum value is 10.
-		Quantity string `json:"quantity"`
+		Quantity StringInt `json:"quantity"`
 
 		// The unique identifier of the product purchased.
 		ProductID string `json:"product_id"`
@@ -89,11 +135,19 @@ type (
 
 		// An indication of whether a subscription is in the free trial period.
 		// https://developer.apple.com/documentation/appstorereceipts/is_trial_period
-		IsTrialPeriod string `json:"is_trial_period"`
+		IsTrialPeriod StringBool `json:"is_trial_period"`
 
 		// An indicator of whether an auto-renewable subscription is in the introductory price period.
 		// https://developer.apple.com/documentation/appstorereceipts/is_in_intro_offer_period.
-		IsInIntroOfferPeriod string `json:"is_in_intro_offer_period,omitempty"`
+		IsInIntroOfferPeriod StringBool `json:"is_in_intro_offer_period"`
+
+		// The identifier of the subscription group to which the subscription belongs.
+		// This field is present only for auto-renewable subscriptions.
+		SubscriptionGroupIdentifier string `json:"subscription_group_identifier,omitempty"`
+
+		// An indicator that the system canceled a subscription because the user upgraded.
+		// This field is only present for upgrade transactions.
+		IsUpgraded StringBool `json:"is_upgraded"`
 
 		ExpiresDate
 		PurchaseDate
@@ -104,8 +158,8 @@ type (
 		// A value of "1" indicates that the customer canceled their transaction due to an actual or perceived issue within your app.
 		// A value of "0" indicates that the transaction was canceled for another reason;
 		// for example, if the customer made the purchase accidentally.
-		// Possible values: 1, 0
-		CancellationReason string `json:"cancellation_reason,omitempty"`
+		// Possible values: CancellationReasonAppIssue, CancellationReasonOther, empty when not cancelled
+		CancellationReason CancellationReason `json:"cancellation_reason,omitempty"`
 	}
 
 	// The decoded version of the encoded receipt data that you send with the request to the App Store.
@@ -218,7 +272,7 @@ type (
 
 		// The time the App Store generated the receipt, in UNIX epoch time format, in milliseconds.
 		// Use this time format for processing dates. This value does not change.
-		CreationDateMS string `json:"receipt_creation_date_ms"`
+		CreationDateMS EpochMillis `json:"receipt_creation_date_ms"`
 
 		// The time the App Store generated the receipt, in the Pacific Time zone.
 		CreationDatePST string `json:"receipt_creation_date_pst"`
@@ -232,7 +286,7 @@ type (
 
 		// The time the request to the verifyReceipt endpoint was processed and the response was generated, in UNIX epoch time format, in milliseconds.
 		// Use this time format for processing dates.
-		RequestDateMS string `json:"request_date_ms"`
+		RequestDateMS EpochMillis `json:"request_date_ms"`
 
 		// The time the request to the verifyReceipt endpoint was processed and the response was generated,
 		// in the Pacific Time zone.
@@ -252,7 +306,7 @@ type (
 		// For auto-renewable subscriptions, the time the App Store charged the user’s account
 		// for a subscription purchase or renewal after a lapse, in the UNIX epoch time format, in milliseconds.
 		// Use this time format for processing dates.
-		PurchaseDateMS string `json:"purchase_date_ms"`
+		PurchaseDateMS EpochMillis `json:"purchase_date_ms"`
 
 		// The time the App Store charged the user's account for a purchased or restored product,
 		// or the time the App Store charged the user’s account
@@ -267,7 +321,7 @@ type (
 
 		// The time of the original app purchase, in UNIX epoch time format, in milliseconds.
 		// Use this time format for processing dates.
-		OriginalPurchaseDateMS string `json:"original_purchase_date_ms"`
+		OriginalPurchaseDateMS EpochMillis `json:"original_purchase_date_ms"`
 
 		// The time of the original app purchase, in the Pacific Time zone.
 		OriginalPurchaseDatePST string `json:"original_purchase_date_pst"`
@@ -282,7 +336,7 @@ type (
 		// The time the user ordered the app available for pre-order, in UNIX epoch time format, in milliseconds.
 		// This field is only present if the user pre-orders the app.
 		// Use this time format for processing dates.
-		PreorderDateMS string `json:"preorder_date_ms"`
+		PreorderDateMS EpochMillis `json:"preorder_date_ms"`
 
 		// The time the user ordered the app available for pre-order, in the Pacific Time zone.
 		PreorderDatePST string `json:"preorder_date_pst"`
@@ -299,7 +353,7 @@ type (
 		// If this key is not present for apps purchased through the Volume Purchase Program,
 		// the receipt does not expire.
 		// Use this time format for processing dates.
-		ExpiresDateMS string `json:"expires_date_ms,omitempty"`
+		ExpiresDateMS EpochMillis `json:"expires_date_ms,omitempty"`
 
 		// The time the receipt expires for apps purchased through the Volume Purchase Program,
 		// in the Pacific Time zone.
@@ -317,7 +371,7 @@ type (
 		// in UNIX epoch time format, in milliseconds.
 		// This field is present only for refunded or revoked transactions.
 		// Use this time format for processing dates. See cancellation_date_ms for more information.
-		CancellationDateMS string `json:"cancellation_date_ms,omitempty"`
+		CancellationDateMS EpochMillis `json:"cancellation_date_ms,omitempty"`
 
 		// The time the App Store refunded a transaction or revoked it from family sharing, in the Pacific Time zone.
 		// This field is present only for refunded or revoked transactions.
@@ -333,7 +387,7 @@ type (
 		// The time at which the grace period for subscription renewals expires, in UNIX epoch time format, in milliseconds.
 		// This key is present only for apps that have Billing Grace Period enabled and when the user experiences a billing error at the time of renewal.
 		// Use this time format for processing dates.
-		GracePeriodDateMS string `json:"grace_period_expires_date_ms,omitempty"`
+		GracePeriodDateMS EpochMillis `json:"grace_period_expires_date_ms,omitempty"`
 
 		// The time at which the grace period for subscription renewals expires, in the Pacific Time zone.
 		GracePeriodDatePST string `json:"grace_period_expires_date_pst,omitempty"`
@@ -348,3 +402,12 @@ func (n *numericString) UnmarshalJSON(b []byte) error {
 	*n = numericString(number.String())
 	return nil
 }
+
+func (r *CancellationReason) UnmarshalJSON(b []byte) error {
+	number, ok := applejson.NumberText(b)
+	if !ok {
+		return ErrInvalidCancellationReason
+	}
+	*r = CancellationReason(number)
+	return nil
+}
@@ -0,0 +1,301 @@
+// parse verifies and decodes receipts locally, without calling the verifyReceipt endpoints.
+package receipt
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of the receipt fields
+// https://developer.apple.com/library/archive/releasenotes/General/ValidateAppStoreReceipt/Chapters/ReceiptFields.html
+const (
+	fieldBundleID                   = 2
+	fieldApplicationVersion         = 3
+	fieldCreationDate               = 12
+	fieldInApp                      = 17
+	fieldOriginalApplicationVersion = 19
+	fieldExpiresDate                = 21
+)
+
+// Types of the in-app purchase receipt fields
+const (
+	fieldQuantity              = 1701
+	fieldProductID             = 1702
+	fieldTransactionID         = 1703
+	fieldPurchaseDate          = 1704
+	fieldOriginalTransactionID = 1705
+	fieldOriginalPurchaseDate  = 1706
+	fieldSubscriptionExpires   = 1708
+	fieldWebOrderLineItemID    = 1711
+	fieldCancellationDate      = 1712
+	fieldIsTrialPeriod         = 1713
+	fieldIsInIntroOfferPeriod  = 1719
+	fieldPromotionalOfferID    = 1721
+)
+
+const (
+	// Format of the dates of the verifyReceipt responses
+	dateLayout = "2006-01-02 15:04:05 Etc/GMT"
+)
+
+var (
+	ErrInvalidPayload   = errors.New("receipt payload is not a valid set of receipt attributes")
+	ErrNotReceiptSigner = errors.New("receipt signer certificate is not a receipt signing certificate")
+	ErrNotWWDRIssuer    = errors.New("receipt signer certificate is not issued by an apple worldwide developer relations intermediate")
+)
+
+// Parser verifies receipts against the Apple Root CA and decodes them,
+// as the verifyReceipt endpoints are deprecated.
+// The device hash and the opaque value of the receipt are not checked.
+type Parser struct {
+	// Trusted root certificates, AppleRoots by default
+	Roots []*x509.Certificate
+
+	// Extension the signer certificate must have, the apple receipt signing extension
+	// 1.2.840.113635.100.6.11.1 by default, so that other certificates of the roots cannot sign receipts
+	SignerOID asn1.ObjectIdentifier
+
+	// Extension the certificate issuing the signer certificate must have, the apple worldwide developer relations
+	// intermediate extension 1.2.840.113635.100.6.2.1 by default
+	IntermediateOID asn1.ObjectIdentifier
+}
+
+// receiptAttribute is an attribute of the receipt payload
+type receiptAttribute struct {
+	Type    int
+	Version int
+	Value   []byte
+}
+
+// Returns new parser trusting the Apple Root CA
+func NewParser() *Parser {
+	return &Parser{
+		Roots:           AppleRoots(),
+		SignerOID:       receiptSigningOID(),
+		IntermediateOID: wwdrIntermediateOID(),
+	}
+}
+
+// Parse verifies the signature and the certificates of the base64 encoded receipt, like IAPRequest.ReceiptData,
+// and decodes its payload.
+// Certificates are checked at the receipt creation date, as the apple certificates expire before the receipts they signed.
+// Date fields have the UTC and milliseconds values, the Pacific Time values are left empty.
+func (p *Parser) Parse(receiptData string) (*Receipt, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(receiptData))
+	if err != nil {
+		return nil, ErrInvalidReceiptData
+	}
+
+	signed, err := parsePKCS7(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasExtension(signed.signer, p.signerOID()) {
+		return nil, ErrNotReceiptSigner
+	}
+
+	if intermediate := issuer(signed.signer, signed.certificates); intermediate == nil || !hasExtension(intermediate, p.intermediateOID()) {
+		return nil, ErrNotWWDRIssuer
+	}
+
+	receipt, err := decodeReceipt(signed.content)
+	if err != nil {
+		return nil, err
+	}
+
+	at := receipt.CreationTime()
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	if err := verifyChain(signed.signer, signed.certificates, p.roots(), at); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+func (p *Parser) roots() []*x509.Certificate {
+	if p.Roots == nil {
+		return AppleRoots()
+	}
+	return p.Roots
+}
+
+func (p *Parser) signerOID() asn1.ObjectIdentifier {
+	if p.SignerOID == nil {
+		return receiptSigningOID()
+	}
+	return p.SignerOID
+}
+
+func (p *Parser) intermediateOID() asn1.ObjectIdentifier {
+	if p.IntermediateOID == nil {
+		return wwdrIntermediateOID()
+	}
+	return p.IntermediateOID
+}
+
+func receiptSigningOID() asn1.ObjectIdentifier {
+	return asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+}
+
+func wwdrIntermediateOID() asn1.ObjectIdentifier {
+	return asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeAttributes(payload []byte) ([]receiptAttribute, error) {
+	var attributes []receiptAttribute
+	if rest, err := asn1.UnmarshalWithParams(payload, &attributes, "set"); err != nil || len(rest) > 0 {
+		return nil, ErrInvalidPayload
+	}
+	return attributes, nil
+}
+
+func decodeReceipt(payload []byte) (*Receipt, error) {
+	attributes, err := decodeAttributes(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &Receipt{InApp: []InApp{}}
+	for _, attr := range attributes {
+		switch attr.Type {
+		case fieldBundleID:
+			err = decodeString(attr.Value, &receipt.BundleID)
+		case fieldApplicationVersion:
+			err = decodeString(attr.Value, &receipt.ApplicationVersion)
+		case fieldOriginalApplicationVersion:
+			err = decodeString(attr.Value, &receipt.OriginalApplicationVersion)
+		case fieldCreationDate:
+			err = decodeDate(attr.Value, &receipt.CreationDate, &receipt.CreationDateMS)
+		case fieldExpiresDate:
+			err = decodeDate(attr.Value, &receipt.ExpiresDate.ExpiresDate, &receipt.ExpiresDateMS)
+		case fieldInApp:
+			var inApp *InApp
+			if inApp, err = decodeInApp(attr.Value); err == nil {
+				receipt.InApp = append(receipt.InApp, *inApp)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return receipt, nil
+}
+
+func decodeInApp(payload []byte) (*InApp, error) {
+	attributes, err := decodeAttributes(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	inApp := &InApp{}
+	for _, attr := range attributes {
+		switch attr.Type {
+		case fieldQuantity:
+			var quantity int64
+			if quantity, err = decodeInt(attr.Value); err == nil {
+				inApp.Quantity = StringInt(quantity)
+			}
+		case fieldProductID:
+			err = decodeString(attr.Value, &inApp.ProductID)
+		case fieldTransactionID:
+			err = decodeString(attr.Value, &inApp.TransactionID)
+		case fieldOriginalTransactionID:
+			err = decodeString(attr.Value, &inApp.OriginalTransactionID)
+		case fieldPromotionalOfferID:
+			err = decodeString(attr.Value, &inApp.PromotionalOfferID)
+		case fieldWebOrderLineItemID:
+			var id int64
+			if id, err = decodeInt(attr.Value); err == nil && id != 0 {
+				inApp.WebOrderLineItemID = strconv.FormatInt(id, 10)
+			}
+		case fieldIsTrialPeriod:
+			var flag int64
+			if flag, err = decodeInt(attr.Value); err == nil {
+				inApp.IsTrialPeriod = flag != 0
+			}
+		case fieldIsInIntroOfferPeriod:
+			var flag int64
+			if flag, err = decodeInt(attr.Value); err == nil {
+				inApp.IsInIntroOfferPeriod = flag != 0
+			}
+		case fieldPurchaseDate:
+			err = decodeDate(attr.Value, &inApp.PurchaseDate.PurchaseDate, &inApp.PurchaseDateMS)
+		case fieldOriginalPurchaseDate:
+			err = decodeDate(attr.Value, &inApp.OriginalPurchaseDate.OriginalPurchaseDate, &inApp.OriginalPurchaseDateMS)
+		case fieldSubscriptionExpires:
+			err = decodeDate(attr.Value, &inApp.ExpiresDate.ExpiresDate, &inApp.ExpiresDateMS)
+		case fieldCancellationDate:
+			err = decodeDate(attr.Value, &inApp.CancellationDate.CancellationDate, &inApp.CancellationDateMS)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return inApp, nil
+}
+
+// decodeString decodes an UTF8String or IA5String value
+func decodeString(value []byte, s *string) error {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(value, &raw); err != nil {
+		return ErrInvalidPayload
+	}
+
+	if raw.Class != asn1.ClassUniversal || (raw.Tag != asn1.TagUTF8String && raw.Tag != asn1.TagIA5String) {
+		return ErrInvalidPayload
+	}
+
+	*s = string(raw.Bytes)
+	return nil
+}
+
+func decodeInt(value []byte) (int64, error) {
+	var i int64
+	if _, err := asn1.Unmarshal(value, &i); err != nil {
+		return 0, ErrInvalidPayload
+	}
+	return i, nil
+}
+
+// decodeDate decodes a RFC 3339 date, an empty date is left zero
+func decodeDate(value []byte, date *string, ms *EpochMillis) error {
+	var s string
+	if err := decodeString(value, &s); err != nil {
+		return err
+	}
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return ErrInvalidPayload
+	}
+
+	*date = t.UTC().Format(dateLayout)
+	*ms = EpochMillis(t.UnixMilli())
+	return nil
+}
@@ -0,0 +1,139 @@
+package receipt_test
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/receipt"
+	"github.com/canopas/apple-sdk-go/receipt/receipttest"
+	"github.com/tj/assert"
+)
+
+func testReceipt(created time.Time) *receipt.Receipt {
+	r := &receipt.Receipt{
+		BundleID:                   "com.example.app",
+		ApplicationVersion:         "2.1",
+		OriginalApplicationVersion: "1.0",
+		InApp: []receipt.InApp{{
+			Quantity:              1,
+			ProductID:             "monthly",
+			TransactionID:         "1000000000000002",
+			OriginalTransactionID: "1000000000000001",
+			IsTrialPeriod:         true,
+		}},
+	}
+	r.CreationDateMS = receipt.EpochMillis(created.UnixMilli())
+	r.InApp[0].PurchaseDateMS = receipt.EpochMillis(created.Add(-time.Hour).UnixMilli())
+	r.InApp[0].OriginalPurchaseDateMS = receipt.EpochMillis(created.Add(-48 * time.Hour).UnixMilli())
+	r.InApp[0].ExpiresDateMS = receipt.EpochMillis(created.Add(30 * 24 * time.Hour).UnixMilli())
+	return r
+}
+
+func TestParser(t *testing.T) {
+	ca := receipttest.NewCA()
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	parsed, err := ca.Parser().Parse(ca.Sign(testReceipt(created)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "com.example.app", parsed.BundleID)
+	assert.Equal(t, "2.1", parsed.ApplicationVersion)
+	assert.Equal(t, "1.0", parsed.OriginalApplicationVersion)
+	assert.Equal(t, created, parsed.CreationTime())
+	assert.Equal(t, "2023-05-01 12:00:00 Etc/GMT", parsed.CreationDate)
+
+	assert.Len(t, parsed.InApp, 1)
+	inApp := parsed.InApp[0]
+	assert.Equal(t, receipt.StringInt(1), inApp.Quantity)
+	assert.Equal(t, "monthly", inApp.ProductID)
+	assert.Equal(t, "1000000000000002", inApp.TransactionID)
+	assert.Equal(t, "1000000000000001", inApp.OriginalTransactionID)
+	assert.True(t, bool(inApp.IsTrialPeriod))
+	assert.False(t, bool(inApp.IsInIntroOfferPeriod))
+	assert.Equal(t, created.Add(-time.Hour), inApp.PurchaseTime())
+	assert.Equal(t, created.Add(30*24*time.Hour), inApp.ExpiresTime())
+	assert.True(t, inApp.CancellationTime().IsZero())
+
+	// parsed receipts work with the entitlements and the validation
+	entitlements := receipt.Entitlements(&receipt.IAPResponse{Receipt: *parsed}, created)
+	assert.Equal(t, receipt.StateActive, entitlements[0].State)
+
+	validation := &receipt.Validation{BundleIDs: []string{"com.example.app"}, ProductIDs: []string{"monthly"}}
+	assert.NoError(t, validation.Validate(&receipt.IAPResponse{Receipt: *parsed}))
+}
+
+func TestParser__sandboxReceipt(t *testing.T) {
+	data, err := os.ReadFile("testdata/sandbox_receipt.pem")
+	assert.NoError(t, err)
+	block, _ := pem.Decode(data)
+
+	// receipt of the App Store sandbox, signed by the apple certificates
+	parsed, err := receipt.NewParser().Parse(base64.StdEncoding.EncodeToString(block.Bytes))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "com.zhihu.test", parsed.BundleID)
+	assert.Equal(t, "1", parsed.ApplicationVersion)
+	assert.Equal(t, "1.0", parsed.OriginalApplicationVersion)
+	assert.Equal(t, "2016-07-23 06:21:11 Etc/GMT", parsed.CreationDate)
+
+	assert.Len(t, parsed.InApp, 1)
+	assert.Equal(t, "com.zhihu.test.test_1", parsed.InApp[0].ProductID)
+	assert.Equal(t, "1000000225325901", parsed.InApp[0].TransactionID)
+	assert.Equal(t, receipt.StringInt(1), parsed.InApp[0].Quantity)
+}
+
+func TestParser__errors(t *testing.T) {
+	ca := receipttest.NewCA()
+	data := ca.Sign(testReceipt(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)))
+
+	// signed by another authority
+	_, err := receipttest.NewCA().Parser().Parse(data)
+	assert.Equal(t, receipt.ErrUntrustedCertificate, err)
+
+	// not signed by apple
+	_, err = receipt.NewParser().Parse(data)
+	assert.Equal(t, receipt.ErrUntrustedCertificate, err)
+
+	// created when the certificates were not valid
+	_, err = ca.Parser().Parse(ca.Sign(testReceipt(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))))
+	assert.Equal(t, receipt.ErrUntrustedCertificate, err)
+
+	// tampered signature, the last bytes of the container
+	der, _ := base64.StdEncoding.DecodeString(data)
+	der[len(der)-1] ^= 0xff
+	_, err = ca.Parser().Parse(base64.StdEncoding.EncodeToString(der))
+	assert.Equal(t, receipt.ErrInvalidSignature, err)
+
+	// signer without the receipt signing extension
+	parser := ca.Parser()
+	parser.SignerOID = asn1.ObjectIdentifier{1, 2, 3}
+	_, err = parser.Parse(data)
+	assert.Equal(t, receipt.ErrNotReceiptSigner, err)
+
+	// signer issued by an intermediate without the worldwide developer relations extension
+	parser = ca.Parser()
+	parser.IntermediateOID = asn1.ObjectIdentifier{1, 2, 3}
+	_, err = parser.Parse(data)
+	assert.Equal(t, receipt.ErrNotWWDRIssuer, err)
+
+	_, err = ca.Parser().Parse(ca.SignPayload([]byte("not a receipt")))
+	assert.Equal(t, receipt.ErrInvalidPayload, err)
+
+	_, err = ca.Parser().Parse(base64.StdEncoding.EncodeToString([]byte("not a container")))
+	assert.Equal(t, receipt.ErrInvalidPKCS7, err)
+
+	_, err = ca.Parser().Parse("%%%")
+	assert.Equal(t, receipt.ErrInvalidReceiptData, err)
+}
+
+func TestAppleRoots(t *testing.T) {
+	roots := receipt.AppleRoots()
+
+	assert.Len(t, roots, 1)
+	assert.Equal(t, "Apple Root CA", roots[0].Subject.CommonName)
+	assert.True(t, roots[0].IsCA)
+}
@@ -0,0 +1,269 @@
+// pkcs7 reads the PKCS#7 signed data container of the receipts and verifies its signature.
+package receipt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+)
+
+const (
+	// Maximum number of intermediate certificates between the signer and the root
+	maxChainDepth = 4
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+var (
+	ErrInvalidPKCS7         = errors.New("receipt is not a PKCS#7 signed data container")
+	ErrUnsupportedAlgorithm = errors.New("receipt is signed with an unsupported algorithm")
+	ErrInvalidSignature     = errors.New("receipt signature is invalid")
+	ErrUntrustedCertificate = errors.New("receipt signer is not certified by the trusted roots")
+)
+
+// contentInfo is the PKCS#7 ContentInfo
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData is the PKCS#7 SignedData
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// signerInfo is the PKCS#7 SignerInfo
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// signedReceipt is a decoded container, with the certificates it carries
+type signedReceipt struct {
+	content      []byte
+	signer       *x509.Certificate
+	certificates []*x509.Certificate
+}
+
+// parsePKCS7 decodes the signed data container, in BER like the App Store receipts or DER,
+// and verifies the signature of its content with the signer certificate.
+// The certificate chain is verified separately by verifyChain.
+func parsePKCS7(ber []byte) (*signedReceipt, error) {
+	der, err := berToDER(ber)
+	if err != nil {
+		return nil, err
+	}
+
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 || !info.ContentType.Equal(oidSignedData) {
+		return nil, ErrInvalidPKCS7
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, ErrInvalidPKCS7
+	}
+
+	if !sd.ContentInfo.ContentType.Equal(oidData) || len(sd.SignerInfos) != 1 {
+		return nil, ErrInvalidPKCS7
+	}
+
+	// the explicit [0] content holds the data octet string
+	var content []byte
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+		return nil, ErrInvalidPKCS7
+	}
+
+	certificates, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, ErrInvalidPKCS7
+	}
+
+	signer := sd.SignerInfos[0]
+
+	var signerCert *x509.Certificate
+	for _, cert := range certificates {
+		if bytes.Equal(cert.RawIssuer, signer.IssuerAndSerialNumber.Issuer.FullBytes) &&
+			cert.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 {
+			signerCert = cert
+			break
+		}
+	}
+
+	if signerCert == nil {
+		return nil, ErrUntrustedCertificate
+	}
+
+	if err := verifySignature(signerCert, &signer, content); err != nil {
+		return nil, err
+	}
+
+	return &signedReceipt{content: content, signer: signerCert, certificates: certificates}, nil
+}
+
+// verifySignature checks the signature of content, or of the authenticated attributes
+// holding the digest of content when the signer sent them
+func verifySignature(cert *x509.Certificate, signer *signerInfo, content []byte) error {
+	hash, err := digestHash(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	algorithm, err := signatureAlgorithm(hash, cert.PublicKeyAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	signed := content
+	if len(signer.AuthenticatedAttributes.Bytes) > 0 {
+		digest, err := messageDigest(signer.AuthenticatedAttributes.Bytes)
+		if err != nil {
+			return err
+		}
+
+		h := hash.New()
+		h.Write(content)
+		if !bytes.Equal(digest, h.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+
+		// the attributes are signed with their universal SET tag, not the implicit [0] tag
+		signed = append([]byte{0x31}, signer.AuthenticatedAttributes.FullBytes[1:]...)
+	}
+
+	if err := cert.CheckSignature(algorithm, signed, signer.EncryptedDigest); err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func messageDigest(attributes []byte) ([]byte, error) {
+	for len(attributes) > 0 {
+		var attr attribute
+		rest, err := asn1.Unmarshal(attributes, &attr)
+		if err != nil {
+			return nil, ErrInvalidPKCS7
+		}
+		attributes = rest
+
+		if attr.Type.Equal(oidMessageDigest) && len(attr.Values) == 1 {
+			var digest []byte
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &digest); err != nil {
+				return nil, ErrInvalidPKCS7
+			}
+			return digest, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
+
+func digestHash(algorithm asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case algorithm.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case algorithm.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+func signatureAlgorithm(hash crypto.Hash, key x509.PublicKeyAlgorithm) (x509.SignatureAlgorithm, error) {
+	switch {
+	case hash == crypto.SHA1 && key == x509.RSA:
+		return x509.SHA1WithRSA, nil
+	case hash == crypto.SHA256 && key == x509.RSA:
+		return x509.SHA256WithRSA, nil
+	case hash == crypto.SHA1 && key == x509.ECDSA:
+		return x509.ECDSAWithSHA1, nil
+	case hash == crypto.SHA256 && key == x509.ECDSA:
+		return x509.ECDSAWithSHA256, nil
+	}
+	return x509.UnknownSignatureAlgorithm, ErrUnsupportedAlgorithm
+}
+
+// verifyChain checks that cert is certified by one of roots through the intermediates, at time at.
+// Signatures are checked with CheckSignature rather than x509.Verify,
+// which rejects the SHA-1 signatures of the apple certificates.
+func verifyChain(cert *x509.Certificate, intermediates, roots []*x509.Certificate, at time.Time) error {
+	for depth := 0; depth <= maxChainDepth; depth++ {
+		if at.Before(cert.NotBefore) || at.After(cert.NotAfter) {
+			return ErrUntrustedCertificate
+		}
+
+		for _, root := range roots {
+			if issuedBy(cert, root) {
+				if at.Before(root.NotBefore) || at.After(root.NotAfter) {
+					return ErrUntrustedCertificate
+				}
+				return nil
+			}
+		}
+
+		var parent *x509.Certificate
+		for _, intermediate := range intermediates {
+			if intermediate != cert && intermediate.BasicConstraintsValid && intermediate.IsCA && issuedBy(cert, intermediate) {
+				parent = intermediate
+				break
+			}
+		}
+
+		if parent == nil {
+			return ErrUntrustedCertificate
+		}
+		cert = parent
+	}
+
+	return ErrUntrustedCertificate
+}
+
+// issuer returns the certificate of certificates that issued cert, or nil
+func issuer(cert *x509.Certificate, certificates []*x509.Certificate) *x509.Certificate {
+	for _, parent := range certificates {
+		if parent != cert && issuedBy(cert, parent) {
+			return parent
+		}
+	}
+	return nil
+}
+
+func issuedBy(cert, parent *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, parent.RawSubject) &&
+		parent.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
@@ -0,0 +1,316 @@
+// Package receipttest builds receipts signed by a test certificate authority,
+// to test local receipt parsing offline.
+package receipttest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/receipt"
+)
+
+var (
+	oidSignedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSHA256         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidReceiptSigning = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	oidWWDR           = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+
+	// Validity of the test certificates, covering the dates of any test receipt
+	notBefore = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter  = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Types of the receipt fields
+const (
+	fieldBundleID                   = 2
+	fieldApplicationVersion         = 3
+	fieldCreationDate               = 12
+	fieldInApp                      = 17
+	fieldOriginalApplicationVersion = 19
+	fieldExpiresDate                = 21
+
+	fieldQuantity              = 1701
+	fieldProductID             = 1702
+	fieldTransactionID         = 1703
+	fieldPurchaseDate          = 1704
+	fieldOriginalTransactionID = 1705
+	fieldOriginalPurchaseDate  = 1706
+	fieldSubscriptionExpires   = 1708
+	fieldCancellationDate      = 1712
+	fieldIsTrialPeriod         = 1713
+	fieldIsInIntroOfferPeriod  = 1719
+	fieldPromotionalOfferID    = 1721
+)
+
+// CA is a certificate authority signing receipts like the App Store:
+// a root certifies an intermediate, which certifies the receipt signer.
+type CA struct {
+	Root *x509.Certificate
+
+	// Intermediate certifying the signer, with the apple worldwide developer relations extension
+	Intermediate *x509.Certificate
+
+	// Certificate signing the receipts, with the apple receipt signing extension
+	Signer    *x509.Certificate
+	SignerKey *rsa.PrivateKey
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type receiptAttribute struct {
+	Type    int
+	Version int
+	Value   []byte
+}
+
+// Returns new certificate authority with fresh keys
+func NewCA() *CA {
+	rootKey := newECDSAKey()
+	intermediateKey := newECDSAKey()
+
+	signerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("receipttest: generating key: " + err.Error())
+	}
+
+	root := newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "receipttest Root CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, rootKey.Public(), rootKey)
+
+	intermediate := newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "receipttest Intermediate CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtraExtensions:       []pkix.Extension{{Id: oidWWDR, Value: asn1.NullBytes}},
+	}, root, intermediateKey.Public(), rootKey)
+
+	signer := newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "receipttest Receipt Signing"},
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtraExtensions:       []pkix.Extension{{Id: oidReceiptSigning, Value: asn1.NullBytes}},
+	}, intermediate, signerKey.Public(), intermediateKey)
+
+	return &CA{Root: root, Intermediate: intermediate, Signer: signer, SignerKey: signerKey}
+}
+
+// Roots returns the root certificate, to trust with receipt.Parser
+func (ca *CA) Roots() []*x509.Certificate {
+	return []*x509.Certificate{ca.Root}
+}
+
+// Parser returns new parser trusting the root certificate
+func (ca *CA) Parser() *receipt.Parser {
+	parser := receipt.NewParser()
+	parser.Roots = ca.Roots()
+	return parser
+}
+
+// Sign returns the base64 encoded signed container of r, like IAPRequest.ReceiptData.
+// Dates are encoded from their milliseconds fields.
+func (ca *CA) Sign(r *receipt.Receipt) string {
+	return ca.SignPayload(Encode(r))
+}
+
+// SignPayload returns the base64 encoded signed container of a raw payload
+func (ca *CA) SignPayload(payload []byte) string {
+	digest := sha256.Sum256(payload)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, ca.SignerKey, crypto.SHA256, digest[:])
+	if err != nil {
+		panic("receipttest: signing receipt: " + err.Error())
+	}
+
+	content := mustMarshal(payload)
+
+	var certificates []byte
+	for _, cert := range []*x509.Certificate{ca.Signer, ca.Intermediate, ca.Root} {
+		certificates = append(certificates, cert.Raw...)
+	}
+
+	sd := mustMarshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo: contentInfo{
+			ContentType: oidData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: ca.Signer.RawIssuer},
+				SerialNumber: ca.Signer.SerialNumber,
+			},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption},
+			EncryptedDigest:           signature,
+		}},
+	})
+
+	container := mustMarshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+
+	return base64.StdEncoding.EncodeToString(container)
+}
+
+// Encode returns the ASN.1 payload of r, the set of receipt attributes
+func Encode(r *receipt.Receipt) []byte {
+	attributes := []receiptAttribute{
+		stringAttribute(fieldBundleID, r.BundleID),
+		stringAttribute(fieldApplicationVersion, r.ApplicationVersion),
+		stringAttribute(fieldOriginalApplicationVersion, r.OriginalApplicationVersion),
+	}
+
+	attributes = appendDate(attributes, fieldCreationDate, r.CreationDateMS)
+	attributes = appendDate(attributes, fieldExpiresDate, r.ExpiresDateMS)
+
+	for i := range r.InApp {
+		attributes = append(attributes, receiptAttribute{Type: fieldInApp, Version: 1, Value: encodeInApp(&r.InApp[i])})
+	}
+
+	return mustMarshalSet(attributes)
+}
+
+func encodeInApp(inApp *receipt.InApp) []byte {
+	attributes := []receiptAttribute{
+		intAttribute(fieldQuantity, int64(inApp.Quantity)),
+		stringAttribute(fieldProductID, inApp.ProductID),
+		stringAttribute(fieldTransactionID, inApp.TransactionID),
+		stringAttribute(fieldOriginalTransactionID, inApp.OriginalTransactionID),
+		intAttribute(fieldIsTrialPeriod, boolInt(bool(inApp.IsTrialPeriod))),
+		intAttribute(fieldIsInIntroOfferPeriod, boolInt(bool(inApp.IsInIntroOfferPeriod))),
+	}
+
+	if inApp.PromotionalOfferID != "" {
+		attributes = append(attributes, stringAttribute(fieldPromotionalOfferID, inApp.PromotionalOfferID))
+	}
+
+	attributes = appendDate(attributes, fieldPurchaseDate, inApp.PurchaseDateMS)
+	attributes = appendDate(attributes, fieldOriginalPurchaseDate, inApp.OriginalPurchaseDateMS)
+	attributes = appendDate(attributes, fieldSubscriptionExpires, inApp.ExpiresDateMS)
+	attributes = appendDate(attributes, fieldCancellationDate, inApp.CancellationDateMS)
+
+	return mustMarshalSet(attributes)
+}
+
+func stringAttribute(field int, value string) receiptAttribute {
+	encoded, err := asn1.MarshalWithParams(value, "utf8")
+	if err != nil {
+		panic("receipttest: encoding attribute: " + err.Error())
+	}
+	return receiptAttribute{Type: field, Version: 1, Value: encoded}
+}
+
+func intAttribute(field int, value int64) receiptAttribute {
+	return receiptAttribute{Type: field, Version: 1, Value: mustMarshal(value)}
+}
+
+// appendDate appends the RFC 3339 date of ms, unless zero
+func appendDate(attributes []receiptAttribute, field int, ms receipt.EpochMillis) []receiptAttribute {
+	if ms.IsZero() {
+		return attributes
+	}
+
+	encoded, err := asn1.MarshalWithParams(ms.Time().Format(time.RFC3339), "ia5")
+	if err != nil {
+		panic("receipttest: encoding date: " + err.Error())
+	}
+	return append(attributes, receiptAttribute{Type: field, Version: 1, Value: encoded})
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func newECDSAKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("receipttest: generating key: " + err.Error())
+	}
+	return key
+}
+
+// newCertificate returns template signed by parent, self-signed when parent is nil
+func newCertificate(template, parent *x509.Certificate, public crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	template.NotBefore = notBefore
+	template.NotAfter = notAfter
+
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, public, signer)
+	if err != nil {
+		panic("receipttest: creating certificate: " + err.Error())
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic("receipttest: parsing certificate: " + err.Error())
+	}
+	return cert
+}
+
+func mustMarshal(value interface{}) []byte {
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		panic("receipttest: encoding: " + err.Error())
+	}
+	return encoded
+}
+
+func mustMarshalSet(attributes []receiptAttribute) []byte {
+	encoded, err := asn1.MarshalWithParams(attributes, "set")
+	if err != nil {
+		panic("receipttest: encoding: " + err.Error())
+	}
+	return encoded
+}
@@ -0,0 +1,27 @@
+package receipttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/canopas/apple-sdk-go/receipt"
+	"github.com/tj/assert"
+)
+
+func TestCA__sign(t *testing.T) {
+	ca := NewCA()
+
+	assert.NoError(t, ca.Intermediate.CheckSignatureFrom(ca.Root))
+	assert.NoError(t, ca.Signer.CheckSignatureFrom(ca.Intermediate))
+
+	r := &receipt.Receipt{BundleID: "com.example.app", InApp: []receipt.InApp{{ProductID: "coins", Quantity: 3}}}
+	r.CreationDateMS = receipt.EpochMillis(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli())
+
+	parsed, err := ca.Parser().Parse(ca.Sign(r))
+
+	assert.NoError(t, err)
+	assert.Equal(t, r.BundleID, parsed.BundleID)
+	assert.Equal(t, r.CreationDateMS, parsed.CreationDateMS)
+	assert.Equal(t, "coins", parsed.InApp[0].ProductID)
+	assert.Equal(t, receipt.StringInt(3), parsed.InApp[0].Quantity)
+}
@@ -0,0 +1,160 @@
+// validation checks that verified receipts belong to the app and its product catalog.
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoBundleIDs = errors.New("validation has no expected bundle identifier")
+
+	// Matched by the errors of the mismatches with errors.Is
+	ErrBundleIDMismatch   = errors.New("the receipt belongs to another app")
+	ErrApplicationVersion = errors.New("the application version of the receipt is not allowed")
+	ErrUnknownProduct     = errors.New("the receipt contains a product outside of the catalog")
+)
+
+// Validation is what a verified receipt must match to be accepted.
+// Receipts of other apps are always rejected: the bundle identifiers are required.
+type Validation struct {
+	// Bundle identifiers of the app, required
+	BundleIDs []string
+
+	// Allowed application versions, inclusive, not checked when empty.
+	// Versions are compared by their dot separated numbers, like 1.2.10 > 1.2.9.
+	// Sandbox receipts are not checked, their application version is always 1.0.
+	MinApplicationVersion string
+	MaxApplicationVersion string
+
+	// Product identifiers of the catalog, products are not checked when empty
+	ProductIDs []string
+}
+
+// BundleIDError is returned for a receipt of another app
+type BundleIDError struct {
+	BundleID string
+}
+
+func (e *BundleIDError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrBundleIDMismatch, e.BundleID)
+}
+
+func (e *BundleIDError) Is(target error) bool {
+	return target == ErrBundleIDMismatch
+}
+
+// ApplicationVersionError is returned for a receipt of a version outside of the allowed range
+type ApplicationVersionError struct {
+	Version string
+}
+
+func (e *ApplicationVersionError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrApplicationVersion, e.Version)
+}
+
+func (e *ApplicationVersionError) Is(target error) bool {
+	return target == ErrApplicationVersion
+}
+
+// ProductError is returned for a transaction of a product outside of the catalog
+type ProductError struct {
+	ProductID     string
+	TransactionID string
+}
+
+func (e *ProductError) Error() string {
+	return fmt.Sprintf("%s: %q in transaction %s", ErrUnknownProduct, e.ProductID, e.TransactionID)
+}
+
+func (e *ProductError) Is(target error) bool {
+	return target == ErrUnknownProduct
+}
+
+// Validate checks the bundle identifier, the application version and the products
+// of the transactions of a verified response.
+// Returns *BundleIDError, *ApplicationVersionError or *ProductError on mismatch.
+func (v *Validation) Validate(resp *IAPResponse) error {
+	if len(v.BundleIDs) == 0 {
+		return ErrNoBundleIDs
+	}
+
+	if !contains(v.BundleIDs, resp.Receipt.BundleID) {
+		return &BundleIDError{BundleID: resp.Receipt.BundleID}
+	}
+
+	if resp.Environment != "Sandbox" && !v.allowedVersion(resp.Receipt.ApplicationVersion) {
+		return &ApplicationVersionError{Version: resp.Receipt.ApplicationVersion}
+	}
+
+	if len(v.ProductIDs) == 0 {
+		return nil
+	}
+
+	for _, transactions := range [][]InApp{resp.Receipt.InApp, resp.LatestReceiptInfo} {
+		for _, transaction := range transactions {
+			if !contains(v.ProductIDs, transaction.ProductID) {
+				return &ProductError{ProductID: transaction.ProductID, TransactionID: transaction.TransactionID}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *Validation) allowedVersion(version string) bool {
+	if v.MinApplicationVersion != "" && compareVersions(version, v.MinApplicationVersion) < 0 {
+		return false
+	}
+
+	if v.MaxApplicationVersion != "" && compareVersions(version, v.MaxApplicationVersion) > 0 {
+		return false
+	}
+
+	return true
+}
+
+// compareVersions compares dot separated versions number by number,
+// and parts which are not numbers as strings. Missing parts are 0.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+
+		aNumber, aErr := strconv.Atoi(aPart)
+		bNumber, bErr := strconv.Atoi(bPart)
+
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+		case aPart != bPart:
+			return strings.Compare(aPart, bPart)
+		}
+	}
+
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
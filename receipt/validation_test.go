@@ -0,0 +1,116 @@
+package receipt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func validResponse() *IAPResponse {
+	return &IAPResponse{
+		Environment: "Production",
+		Receipt: Receipt{
+			BundleID:           "com.example.app",
+			ApplicationVersion: "2.10.1",
+			InApp:              []InApp{{ProductID: "monthly", TransactionID: "1"}},
+		},
+		LatestReceiptInfo: []InApp{{ProductID: "yearly", TransactionID: "2"}},
+	}
+}
+
+func TestValidation(t *testing.T) {
+	validation := &Validation{
+		BundleIDs:             []string{"com.example.app", "com.example.app.mac"},
+		MinApplicationVersion: "2.9",
+		MaxApplicationVersion: "3",
+		ProductIDs:            []string{"monthly", "yearly"},
+	}
+
+	assert.NoError(t, validation.Validate(validResponse()))
+
+	resp := validResponse()
+	resp.Receipt.BundleID = "com.other.app"
+	err := validation.Validate(resp)
+	assert.True(t, errors.Is(err, ErrBundleIDMismatch))
+	assert.Equal(t, &BundleIDError{BundleID: "com.other.app"}, err)
+
+	for _, version := range []string{"2.8.9", "3.0.1", "10"} {
+		resp = validResponse()
+		resp.Receipt.ApplicationVersion = version
+		err = validation.Validate(resp)
+		assert.True(t, errors.Is(err, ErrApplicationVersion), version)
+	}
+
+	// the application version of sandbox receipts is always 1.0
+	resp = validResponse()
+	resp.Environment = "Sandbox"
+	resp.Receipt.ApplicationVersion = "1.0"
+	assert.NoError(t, validation.Validate(resp))
+
+	resp = validResponse()
+	resp.LatestReceiptInfo[0].ProductID = "lifetime"
+	err = validation.Validate(resp)
+	assert.True(t, errors.Is(err, ErrUnknownProduct))
+	assert.Equal(t, &ProductError{ProductID: "lifetime", TransactionID: "2"}, err)
+
+	// receipts are rejected without expected bundle identifiers
+	assert.Equal(t, ErrNoBundleIDs, (&Validation{}).Validate(validResponse()))
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.0", "1"))
+	assert.Equal(t, 1, compareVersions("1.2.10", "1.2.9"))
+	assert.Equal(t, -1, compareVersions("1.2", "1.2.1"))
+	assert.Equal(t, -1, compareVersions("1.2-beta", "1.2-rc"))
+}
+
+type bodyHTTPClient string
+
+func (c bodyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	recorder.WriteString(string(c))
+	return recorder.Result(), nil
+}
+
+func TestVerify__validation(t *testing.T) {
+	cli := Client{
+		HttpClient: bodyHTTPClient(`{"status":0,"environment":"Production","receipt":{"bundle_id":"com.other.app"}}`),
+		Validation: &Validation{BundleIDs: []string{"com.example.app"}},
+	}
+
+	gotResp, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Nil(t, gotResp)
+	assert.True(t, errors.Is(gotErr, ErrBundleIDMismatch))
+
+	// invalid receipts are returned with their status, without validation
+	cli.HttpClient = bodyHTTPClient(`{"status":21003}`)
+
+	gotResp, gotErr = cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Nil(t, gotErr)
+	assert.Equal(t, 21003, gotResp.Status)
+}
+
+func TestVerify__rejectsOtherAppsByDefault(t *testing.T) {
+	foreign := bodyHTTPClient(`{"status":0,"environment":"Production","receipt":{"bundle_id":"com.other.app"}}`)
+
+	// without bundle identifiers, the App Store is not called
+	httpCli := &statusHTTPClient{}
+	for _, cli := range []*Client{WithDefaultClient(""), WithCustomClient(httpCli, ""), {HttpClient: httpCli}} {
+		gotResp, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+		assert.Nil(t, gotResp)
+		assert.Equal(t, ErrNoBundleIDs, gotErr)
+	}
+	assert.Equal(t, 0, httpCli.calls)
+
+	gotResp, gotErr := WithCustomClient(foreign, "com.example.app").Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Nil(t, gotResp)
+	assert.Equal(t, &BundleIDError{BundleID: "com.other.app"}, gotErr)
+}
@@ -7,7 +7,11 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/canopas/apple-sdk-go/retry"
 )
 
 const (
@@ -19,66 +23,149 @@ const (
 	CONTENT_TYPE = "application/json; charset=utf-8"
 )
 
-// Returns new IAP request with defult client
-func WithDefaultClient() *Client {
-	return &Client{
-		HttpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-	}
+// Operations of the calls reported to hooks
+const (
+	OperationVerify = "verify"
+
+	// Verification with the sandbox after production answered 21007
+	OperationVerifySandbox = "verify_sandbox"
+
+	// Verification with production after the sandbox answered 21008
+	OperationVerifyProduction = "verify_production"
+)
+
+// Returns new IAP request with defult client, accepting receipts of the app with bundleID.
+// Add the bundle identifiers of other apps to the BundleIDs of the client validation.
+func WithDefaultClient(bundleID string) *Client {
+	return WithCustomClient(&http.Client{
+		Timeout: 10 * time.Second,
+	}, bundleID)
 }
 
-// Returns new IAP request with given client
-func WithCustomClient(client httpClient) *Client {
+// Returns new IAP request with given client, accepting receipts of the app with bundleID
+func WithCustomClient(client httpClient, bundleID string) *Client {
+	validation := &Validation{}
+	if bundleID != "" {
+		validation.BundleIDs = []string{bundleID}
+	}
+
 	return &Client{
 		HttpClient: client,
+		Validation: validation,
 	}
 }
 
-// Verify receipts and gets result from app store endpoints
+// Verify receipts and gets result from app store endpoints, routed by the environment policy of the client.
+// The Endpoint of the response is the endpoint which served it.
+// Valid receipts are checked with the validation of the client.
+// Returns ErrNoBundleIDs without calling the App Store when the validation has no bundle identifier,
+// so that receipts of other apps are never accepted.
 func (client *Client) Verify(ctx context.Context, req IAPRequest) (response *IAPResponse, err error) {
+	if client.Validation == nil || len(client.Validation.BundleIDs) == 0 {
+		return nil, ErrNoBundleIDs
+	}
 
-	response, err = client.validateRequest(ctx, req, PRODUCTION_URL)
+	route, err := client.Environment.route()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err = client.verify(ctx, req, route.url, OperationVerify)
 	if err != nil {
 		return
 	}
 
-	// If receipt is from sandbox env
-	if response.Status == 21007 {
-		response, err = client.validateRequest(ctx, req, SANDBOX_URL)
+	// If receipt is from the other environment
+	if route.fallbackURL != "" && response.Status == route.fallbackStatus {
+		response, err = client.verify(ctx, req, route.fallbackURL, route.fallbackOperation)
 
 		if err != nil {
 			return
 		}
 	}
 
+	if response.Status == 0 {
+		if err = client.Validation.Validate(response); err != nil {
+			return nil, err
+		}
+	}
+
 	return
 }
 
-// validates receipt request with production or sandbox urls
-func (client *Client) validateRequest(ctx context.Context, req IAPRequest, url string) (*IAPResponse, error) {
+// verify validates the receipt with url, again on temporary failures with the retry policy,
+// and reports the call to the hooks.
+// When attempts run out on a temporary status, like 21005, the last response is returned.
+func (client *Client) verify(ctx context.Context, req IAPRequest, url, operation string) (*IAPResponse, error) {
+	ctx, end := observe.Start(ctx, client.Hooks, &observe.Call{
+		Service:   observe.ServiceReceipt,
+		Operation: operation,
+		Endpoint:  url,
+	})
+
+	var response *IAPResponse
+	var statusCode int
+	attempts, err := client.Retry.Do(ctx, func(attempt int) error {
+		resp, status, err := client.sendRequest(ctx, req, url)
+		statusCode = status
+		if err != nil {
+			if retry.Temporary(err) {
+				return retry.Retryable(err, 0)
+			}
+			return err
+		}
+
+		response = resp
+		if resp.Status == 21005 || resp.IsRetryable {
+			return retry.Retryable(errRetryableStatus, 0)
+		}
+		return nil
+	})
+
+	if err == errRetryableStatus {
+		err = nil
+	}
+
+	result := &observe.Result{StatusCode: statusCode, Attempts: attempts, Err: err}
+	if err == nil && response.Status != 0 {
+		result.AppleCode = strconv.Itoa(response.Status)
+	}
+	end(result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response.Endpoint = url
+	return response, nil
+}
+
+// sendRequest posts the receipt to url, and returns the response and its HTTP status
+func (client *Client) sendRequest(ctx context.Context, req IAPRequest, url string) (*IAPResponse, int, error) {
 	b := new(bytes.Buffer)
 	if err := json.NewEncoder(b).Encode(req); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	newReq, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	newReq.Header.Add("content-type", CONTENT_TYPE)
 
 	response, err := client.HttpClient.Do(newReq)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if response.StatusCode >= 500 {
-		return nil, ErrAppStoreServer
+		response.Body.Close()
+		return nil, response.StatusCode, retry.Retryable(ErrAppStoreServer, retry.RetryAfter(response.Header))
 	}
 
-	return parseResponse(response)
+	result, err := parseResponse(response)
+	return result, response.StatusCode, err
 }
 
 // parse http response in IAP response
@@ -2,9 +2,14 @@ package receipt
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/canopas/apple-sdk-go/observe"
+	"github.com/canopas/apple-sdk-go/retry"
 	"github.com/stretchr/testify/mock"
 	"github.com/tj/assert"
 )
@@ -23,7 +28,7 @@ func TestValidateRequest(t *testing.T) {
 	cli := Client{
 		HttpClient: new(MockedHTTPClient),
 	}
-	gotResp, gotErr := cli.validateRequest(context.Background(), IAPRequest{ReceiptData: "", Password: ""}, SANDBOX_URL)
+	gotResp, gotErr := cli.verify(context.Background(), IAPRequest{ReceiptData: "", Password: ""}, SANDBOX_URL, OperationVerifySandbox)
 
 	assert.Equal(t, ErrInvalidReceiptData, gotErr)
 	assert.NotEqual(t, nil, gotResp)
@@ -32,6 +37,7 @@ func TestValidateRequest(t *testing.T) {
 func TestVerify(t *testing.T) {
 	cli := Client{
 		HttpClient: new(MockedHTTPClient),
+		Validation: testValidation(),
 	}
 	gotResp, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "", Password: ""})
 
@@ -49,3 +55,138 @@ func TestHandleErrors(t *testing.T) {
 	gotResp = HandleErrors(21010)
 	assert.Equal(t, ErrReceiptUnauthorized, gotResp)
 }
+
+// Validation accepting the receipts of the app answered by statusHTTPClient
+func testValidation() *Validation {
+	return &Validation{BundleIDs: []string{"com.example.app"}}
+}
+
+// HTTP client which answers with the given statuses, then with a valid receipt
+type statusHTTPClient struct {
+	statuses []int
+	calls    int
+	urls     []string
+}
+
+func (c *statusHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls++
+	c.urls = append(c.urls, req.URL.String())
+
+	recorder := httptest.NewRecorder()
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+
+		if status < 1000 {
+			recorder.WriteHeader(status)
+		} else {
+			fmt.Fprintf(recorder, `{"status":%d,"is-retryable":true}`, status)
+		}
+		return recorder.Result(), nil
+	}
+
+	recorder.WriteString(`{"status":0,"environment":"Production","receipt":{"bundle_id":"com.example.app"}}`)
+	return recorder.Result(), nil
+}
+
+func TestVerify__retry(t *testing.T) {
+	httpCli := &statusHTTPClient{statuses: []int{http.StatusServiceUnavailable, 21005}}
+	cli := Client{
+		HttpClient: httpCli,
+		Retry:      &retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		Validation: testValidation(),
+	}
+
+	gotResp, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Nil(t, gotErr)
+	assert.Equal(t, 0, gotResp.Status)
+	assert.Equal(t, 3, httpCli.calls)
+
+	// the last response is returned when attempts run out
+	httpCli = &statusHTTPClient{statuses: []int{21005, 21005, 21005}}
+	cli.HttpClient = httpCli
+
+	gotResp, gotErr = cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Nil(t, gotErr)
+	assert.Equal(t, ErrServerUnavailable, HandleErrors(gotResp.Status))
+	assert.Equal(t, 3, httpCli.calls)
+
+	// without policy, a single attempt is made
+	httpCli = &statusHTTPClient{statuses: []int{http.StatusBadGateway}}
+	cli = Client{HttpClient: httpCli, Validation: testValidation()}
+
+	_, gotErr = cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Equal(t, ErrAppStoreServer, gotErr)
+	assert.Equal(t, 1, httpCli.calls)
+}
+
+type recordingHooks struct {
+	operations []string
+	results    []observe.Result
+}
+
+func (h *recordingHooks) Start(ctx context.Context, call *observe.Call) context.Context {
+	h.operations = append(h.operations, call.Operation)
+	return ctx
+}
+
+func (h *recordingHooks) End(ctx context.Context, call *observe.Call, result *observe.Result) {
+	h.results = append(h.results, *result)
+}
+
+func TestVerify__hooks(t *testing.T) {
+	hooks := &recordingHooks{}
+	cli := Client{
+		HttpClient: &statusHTTPClient{statuses: []int{21007}},
+		Hooks:      hooks,
+		Validation: testValidation(),
+	}
+
+	gotResp, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+	assert.Nil(t, gotErr)
+	assert.Equal(t, 0, gotResp.Status)
+	assert.Equal(t, []string{OperationVerify, OperationVerifySandbox}, hooks.operations)
+	assert.Equal(t, "21007", hooks.results[0].AppleCode)
+	assert.Equal(t, http.StatusOK, hooks.results[1].StatusCode)
+	assert.Equal(t, "", hooks.results[1].AppleCode)
+}
+
+func TestVerify__environment(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   EnvironmentPolicy
+		statuses []int
+		urls     []string
+		status   int
+	}{
+		{"production receipt", ProductionWithSandboxFallback, nil, []string{PRODUCTION_URL}, 0},
+		{"sandbox fallback", ProductionWithSandboxFallback, []int{21007}, []string{PRODUCTION_URL, SANDBOX_URL}, 0},
+		{"production only", ProductionOnly, []int{21007}, []string{PRODUCTION_URL}, 21007},
+		{"sandbox only", SandboxOnly, []int{21008}, []string{SANDBOX_URL}, 21008},
+		{"sandbox first", SandboxFirst, nil, []string{SANDBOX_URL}, 0},
+		{"production fallback", SandboxFirst, []int{21008}, []string{SANDBOX_URL, PRODUCTION_URL}, 0},
+		{"no fallback on other status", SandboxFirst, []int{21007}, []string{SANDBOX_URL}, 21007},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			httpCli := &statusHTTPClient{statuses: test.statuses}
+			cli := Client{HttpClient: httpCli, Environment: test.policy, Validation: testValidation()}
+
+			gotResp, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+
+			assert.Nil(t, gotErr)
+			assert.Equal(t, test.status, gotResp.Status)
+			assert.Equal(t, test.urls, httpCli.urls)
+			assert.Equal(t, test.urls[len(test.urls)-1], gotResp.Endpoint)
+		})
+	}
+
+	cli := Client{HttpClient: &statusHTTPClient{}, Environment: EnvironmentPolicy(42), Validation: testValidation()}
+	_, gotErr := cli.Verify(context.Background(), IAPRequest{ReceiptData: "receipt-data"})
+	assert.Equal(t, ErrInvalidEnvironment, gotErr)
+}
@@ -0,0 +1,142 @@
+// breaker stops calling apple while its endpoints keep failing.
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of consecutive failures which open the circuit
+	DEFAULT_FAILURE_THRESHOLD = 5
+
+	// Time the circuit stays open before a trial call
+	DEFAULT_OPEN_TIMEOUT = 30 * time.Second
+)
+
+var (
+	ErrCircuitOpen = errors.New("apple is failing, calls are suspended by the circuit breaker")
+)
+
+// Breaker opens after FailureThreshold consecutive temporary failures,
+// failing calls fast for OpenTimeout. It then lets one trial call through:
+// the circuit closes when it succeeds and opens again when it fails.
+// A nil Breaker allows all calls. It is safe for concurrent use.
+type Breaker struct {
+	// Consecutive failures which open the circuit, defaults to DEFAULT_FAILURE_THRESHOLD
+	FailureThreshold int
+
+	// Time the circuit stays open, defaults to DEFAULT_OPEN_TIMEOUT
+	OpenTimeout time.Duration
+
+	// Returns current time, defaults to time.Now
+	Now func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// Returns new breaker opening after threshold failures for timeout
+func NewBreaker(threshold int, timeout time.Duration) *Breaker {
+	return &Breaker{FailureThreshold: threshold, OpenTimeout: timeout}
+}
+
+// Allow returns ErrCircuitOpen while the circuit is open
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold() {
+		return nil
+	}
+
+	if b.trial || b.now().Sub(b.openedAt) < b.timeout() {
+		return ErrCircuitOpen
+	}
+
+	// half open, a single call tests whether apple recovered
+	b.trial = true
+	return nil
+}
+
+// Success records a call answered by apple and closes the circuit
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure records a temporary failure, opening the circuit at the threshold
+func (b *Breaker) Failure() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold() {
+		b.openedAt = b.now()
+	}
+}
+
+// release ends a trial call without outcome, like a cancelled one,
+// so that the next call tests apple again
+func (b *Breaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// Open reports whether calls are currently failed fast
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures >= b.threshold() && (b.trial || b.now().Sub(b.openedAt) < b.timeout())
+}
+
+func (b *Breaker) threshold() int {
+	if b.FailureThreshold <= 0 {
+		return DEFAULT_FAILURE_THRESHOLD
+	}
+	return b.FailureThreshold
+}
+
+func (b *Breaker) timeout() time.Duration {
+	if b.OpenTimeout <= 0 {
+		return DEFAULT_OPEN_TIMEOUT
+	}
+	return b.OpenTimeout
+}
+
+func (b *Breaker) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
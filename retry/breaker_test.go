@@ -0,0 +1,124 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	breaker := NewBreaker(2, time.Minute)
+	breaker.Now = func() time.Time { return now }
+
+	policy := &Policy{MaxAttempts: 1, Breaker: breaker}
+	fail := func(attempt int) error { return Retryable(errTemporary, 0) }
+
+	_, _ = policy.Do(context.Background(), fail)
+	assert.False(t, breaker.Open())
+
+	_, _ = policy.Do(context.Background(), fail)
+	assert.True(t, breaker.Open())
+
+	calls := 0
+	attempts, err := policy.Do(context.Background(), func(attempt int) error {
+		calls++
+		return nil
+	})
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 0, attempts)
+	assert.Equal(t, 0, calls)
+
+	// a trial call is let through after the timeout, and closes the circuit when it succeeds
+	now = now.Add(time.Minute)
+	assert.Nil(t, breaker.Allow())
+	assert.Equal(t, ErrCircuitOpen, breaker.Allow())
+
+	breaker.Success()
+	assert.False(t, breaker.Open())
+
+	var nilBreaker *Breaker
+	assert.Nil(t, nilBreaker.Allow())
+}
+
+func TestBreaker__record(t *testing.T) {
+	answered := errors.New("invalid_grant")
+	dial := &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	tls := &url.Error{Op: "Post", Err: x509.UnknownAuthorityError{}}
+
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+	}{
+		{"success", nil, 0},
+		{"answered with an error", answered, 0},
+		{"retryable failure", Retryable(errTemporary, 0), 1},
+		{"server error not retried", Failed(errTemporary), 1},
+		{"network failure not retried", dial, 1},
+		{"invalid certificate", tls, 0},
+		{"cancelled", context.Canceled, 0},
+		{"deadline", fmt.Errorf("post: %w", context.DeadlineExceeded), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := NewBreaker(5, time.Minute)
+
+			// a previous failure shows whether the attempt reset the count
+			breaker.Failure()
+
+			policy := &Policy{MaxAttempts: 1, Breaker: breaker}
+			_, err := policy.Do(context.Background(), func(attempt int) error { return test.err })
+
+			assert.Equal(t, unwrap(test.err), err)
+
+			expected := test.failures + 1
+			if test.err == nil || test.err == answered || test.err == tls {
+				expected = 0
+			}
+			assert.Equal(t, expected, breaker.failures)
+		})
+	}
+}
+
+func TestBreaker__nonRetriedFailuresOpen(t *testing.T) {
+	breaker := NewBreaker(3, time.Minute)
+	policy := &Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, Breaker: breaker}
+
+	// server errors of non idempotent calls are not retried, but open the circuit
+	for i := 0; i < 3; i++ {
+		attempts, err := policy.Do(context.Background(), func(attempt int) error { return Failed(errTemporary) })
+		assert.Equal(t, 1, attempts)
+		assert.Equal(t, errTemporary, err)
+	}
+
+	assert.True(t, breaker.Open())
+}
+
+func TestBreaker__cancelledTrial(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	breaker := NewBreaker(1, time.Minute)
+	breaker.Now = func() time.Time { return now }
+	breaker.Failure()
+
+	now = now.Add(2 * time.Minute)
+	policy := &Policy{MaxAttempts: 1, Breaker: breaker}
+
+	// the cancelled trial neither closes nor reopens the circuit, the next call is a trial
+	_, err := policy.Do(context.Background(), func(attempt int) error { return context.Canceled })
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = policy.Do(context.Background(), func(attempt int) error { return nil })
+	assert.Nil(t, err)
+	assert.False(t, breaker.Open())
+}
@@ -0,0 +1,285 @@
+// Package retry retries calls to apple endpoints which failed temporarily,
+// with exponential backoff, jitter and an optional circuit breaker.
+// It is shared by the auth and receipt clients.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Number of attempts, including the first one, when none is given
+	DEFAULT_MAX_ATTEMPTS = 3
+
+	// Delay before the first retry, doubled for each further retry
+	DEFAULT_BASE_DELAY = 200 * time.Millisecond
+
+	// Upper bound of the delay between attempts
+	DEFAULT_MAX_DELAY = 5 * time.Second
+)
+
+// Policy decides how often and how late failed calls are attempted again.
+// The zero value uses the defaults. A Policy is safe for concurrent use.
+type Policy struct {
+	// Number of attempts, including the first one, defaults to DEFAULT_MAX_ATTEMPTS
+	MaxAttempts int
+
+	// Delay before the first retry, defaults to DEFAULT_BASE_DELAY
+	BaseDelay time.Duration
+
+	// Upper bound of the delay between attempts, defaults to DEFAULT_MAX_DELAY.
+	// Calls asked by Retry-After to wait longer are not attempted again.
+	MaxDelay time.Duration
+
+	// Breaker fails calls fast while apple is degraded, none when nil
+	Breaker *Breaker
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// retryableError marks an error as temporary
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// failedError marks an error as a failure of apple which is not attempted again
+type failedError struct {
+	err error
+}
+
+func (e *failedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *failedError) Unwrap() error {
+	return e.err
+}
+
+// Returns new policy with the default attempts and delays
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxAttempts: DEFAULT_MAX_ATTEMPTS,
+		BaseDelay:   DEFAULT_BASE_DELAY,
+		MaxDelay:    DEFAULT_MAX_DELAY,
+	}
+}
+
+// Retryable marks err as temporary, so that Do attempts the call again.
+// A positive retryAfter, like the Retry-After header of apple, replaces the backoff delay.
+// Errors which are not marked are returned at once.
+func Retryable(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err, retryAfter: retryAfter}
+}
+
+// Failed marks err as a failure of apple which must not be attempted again,
+// like a server error of a non idempotent request, so that it still counts for the breaker.
+func Failed(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &failedError{err: err}
+}
+
+// IsRetryable reports whether err was marked with Retryable
+func IsRetryable(err error) bool {
+	var rErr *retryableError
+	return errors.As(err, &rErr)
+}
+
+// Do calls fn until it succeeds, returns an error not marked with Retryable,
+// attempts run out, or the next attempt would not start before the ctx deadline.
+// Errors asking to wait longer than MaxDelay are returned at once, apple would reject an earlier attempt.
+// fn gets the number of the attempt, starting at 1.
+// Each attempt is recorded by the breaker of the policy, see Failed.
+// It returns the number of attempts made and the error of the last one, unmarked.
+// A nil policy makes a single attempt.
+func (p *Policy) Do(ctx context.Context, fn func(attempt int) error) (int, error) {
+	if p == nil {
+		return 1, unwrap(fn(1))
+	}
+
+	attempt := 0
+	for {
+		attempt++
+
+		if err := p.Breaker.Allow(); err != nil {
+			return attempt - 1, err
+		}
+
+		err := fn(attempt)
+		p.record(err)
+
+		var rErr *retryableError
+		if !errors.As(err, &rErr) {
+			return attempt, unwrap(err)
+		}
+
+		if attempt >= p.maxAttempts() || ctx.Err() != nil || rErr.retryAfter > p.maxDelay() {
+			return attempt, rErr.err
+		}
+
+		delay := p.delay(attempt, rErr.retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return attempt, rErr.err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, rErr.err
+		case <-timer.C:
+		}
+	}
+}
+
+// record reports the outcome of an attempt to the breaker.
+// Cancelled attempts are not recorded. Errors marked with Retryable or Failed
+// and network failures are failures of apple, other errors are answers of apple.
+func (p *Policy) record(err error) {
+	var fErr *failedError
+	switch {
+	case err == nil:
+		p.Breaker.Success()
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		p.Breaker.release()
+	case IsRetryable(err), errors.As(err, &fErr), Temporary(err):
+		p.Breaker.Failure()
+	default:
+		p.Breaker.Success()
+	}
+}
+
+// delay returns the wait before the attempt following attempt,
+// retryAfter when given, otherwise a random delay up to the exponential backoff
+func (p *Policy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	maxDelay := p.maxDelay()
+
+	backoff := p.BaseDelay
+	if backoff <= 0 {
+		backoff = DEFAULT_BASE_DELAY
+	}
+
+	for i := 1; i < attempt && backoff < maxDelay; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxDelay {
+		backoff = maxDelay
+	}
+
+	// full jitter spreads the retries of concurrent callers
+	return time.Duration(p.float64() * float64(backoff))
+}
+
+func (p *Policy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return DEFAULT_MAX_ATTEMPTS
+	}
+	return p.MaxAttempts
+}
+
+func (p *Policy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return DEFAULT_MAX_DELAY
+	}
+	return p.MaxDelay
+}
+
+func (p *Policy) float64() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.random == nil {
+		p.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return p.random.Float64()
+}
+
+func unwrap(err error) error {
+	var rErr *retryableError
+	if errors.As(err, &rErr) {
+		return rErr.err
+	}
+
+	var fErr *failedError
+	if errors.As(err, &fErr) {
+		return fErr.err
+	}
+	return err
+}
+
+// RetryAfter returns the delay of the Retry-After header, in seconds or as HTTP date.
+// Returns 0 when the header is missing or invalid.
+func RetryAfter(header http.Header) time.Duration {
+	value := header.Get("retry-after")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+// NotSent reports whether the request failed before reaching apple,
+// like a refused connection, so that even non idempotent requests can be sent again.
+func NotSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// Temporary reports whether err is a network failure worth retrying for idempotent requests:
+// a timeout, or a connection reset or refused. Context cancellation and deadline errors are not,
+// nor are other failures like invalid certificates, unsupported schemes or refused redirects.
+func Temporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED)
+}
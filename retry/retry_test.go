@@ -0,0 +1,142 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTemporary = errors.New("apple is unavailable")
+
+func fastPolicy() *Policy {
+	return &Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+}
+
+func TestDo(t *testing.T) {
+	attempts, err := fastPolicy().Do(context.Background(), func(attempt int) error {
+		if attempt < 3 {
+			return Retryable(errTemporary, 0)
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDo__exhausted(t *testing.T) {
+	attempts, err := fastPolicy().Do(context.Background(), func(attempt int) error {
+		return Retryable(errTemporary, 0)
+	})
+
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDo__permanent(t *testing.T) {
+	permanent := errors.New("invalid_grant")
+
+	attempts, err := fastPolicy().Do(context.Background(), func(attempt int) error {
+		return permanent
+	})
+
+	assert.Equal(t, permanent, err)
+	assert.Equal(t, 1, attempts)
+
+	var policy *Policy
+	attempts, err = policy.Do(context.Background(), func(attempt int) error {
+		return Retryable(errTemporary, 0)
+	})
+
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDo__deadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	policy := &Policy{MaxAttempts: 5, MaxDelay: time.Minute}
+
+	// a retry after the deadline is not attempted
+	start := time.Now()
+	attempts, err := policy.Do(ctx, func(attempt int) error {
+		return Retryable(errTemporary, time.Second)
+	})
+
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestDelay(t *testing.T) {
+	policy := &Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		delay := policy.delay(attempt, 0)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, time.Second)
+	}
+
+	assert.Equal(t, 3*time.Millisecond, policy.delay(1, 3*time.Millisecond))
+}
+
+func TestDo__retryAfterTooLong(t *testing.T) {
+	policy := &Policy{MaxAttempts: 3, MaxDelay: time.Second}
+
+	// apple asks to wait longer than the policy allows, the rate limit error is returned
+	start := time.Now()
+	attempts, err := policy.Do(context.Background(), func(attempt int) error {
+		return Retryable(errTemporary, time.Minute)
+	})
+
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, RetryAfter(http.Header{"Retry-After": {"2"}}))
+	assert.Equal(t, time.Duration(0), RetryAfter(http.Header{}))
+	assert.Equal(t, time.Duration(0), RetryAfter(http.Header{"Retry-After": {"soon"}}))
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	delay := RetryAfter(http.Header{"Retry-After": {date}})
+	assert.Greater(t, delay, 50*time.Second)
+}
+
+func TestNotSent(t *testing.T) {
+	assert.True(t, NotSent(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.False(t, NotSent(&net.OpError{Op: "read", Err: errors.New("connection reset")}))
+
+	assert.True(t, Temporary(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}))
+	assert.False(t, Temporary(context.DeadlineExceeded))
+}
+
+func TestTemporary(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		temporary bool
+	}{
+		"reset":     {&url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		"refused":   {&url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		"timeout":   {&url.Error{Op: "Post", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}, true},
+		"tls":       {&url.Error{Op: "Post", Err: x509.UnknownAuthorityError{}}, false},
+		"scheme":    {&url.Error{Op: "Post", Err: errors.New("unsupported protocol scheme \"ftp\"")}, false},
+		"redirect":  {&url.Error{Op: "Post", Err: errors.New("stopped after 10 redirects")}, false},
+		"cancelled": {&url.Error{Op: "Post", Err: context.Canceled}, false},
+	}
+
+	for name, test := range tests {
+		assert.Equal(t, test.temporary, Temporary(test.err), name)
+	}
+}